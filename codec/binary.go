@@ -0,0 +1,250 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"x/buffers"
+)
+
+// A binary envelope is made of
+//
+//	uvarint  type id
+//	uvarint  flags, a set of the flag bits below
+//	uvarint  version of the data, if flagVersion is set
+//	uvarint  checksum and its digest of the data, if flagDigest is set
+//	uvarint  length of the key id, the key id and the HMAC-SHA256, if
+//	         flagSignature is set
+//	uvarint  length of the data
+//	[]byte   data, as encoded by the json.Driver of the Codec
+//
+// Binary envelopes are self-delimiting, so they are written back to back to a
+// stream without any framing.
+
+const (
+	flagVersion uint64 = 1 << iota
+	flagDigest
+	flagSignature
+
+	knownFlags = flagVersion | flagDigest | flagSignature
+)
+
+// maxKeyIDLen bounds the key ids of binary envelopes.
+const maxKeyIDLen = 255
+
+var errTrailingData = errors.New("trailing data after envelope")
+
+// binaryHeader is the header of a binary envelope, before the length of its data.
+type binaryHeader struct {
+	id      uint64
+	flags   uint64
+	version uint64
+	seal    seal
+}
+
+// readBinaryHeader reads a header with next, which reads a single uvarint, and
+// read, which reads n bytes.
+func readBinaryHeader(next func() (uint64, error), read func(n int) ([]byte, error)) (h binaryHeader, err error) {
+	if h.id, err = next(); err != nil {
+		return h, err
+	}
+	if h.flags, err = next(); err != nil {
+		return h, noEOF(err)
+	}
+	if h.flags&flagVersion != 0 {
+		if h.version, err = next(); err != nil {
+			return h, noEOF(err)
+		}
+	}
+	if h.flags&flagDigest != 0 {
+		sum, err := next()
+		if err != nil {
+			return h, noEOF(err)
+		}
+		h.seal.sum = Checksum(sum)
+		if sum > math.MaxUint8 || h.seal.sum.size() == 0 {
+			return h, fmt.Errorf("unknown checksum %d", sum)
+		}
+		if h.seal.digest, err = read(h.seal.sum.size()); err != nil {
+			return h, noEOF(err)
+		}
+	}
+	if h.flags&flagSignature != 0 {
+		n, err := next()
+		if err != nil {
+			return h, noEOF(err)
+		}
+		if n > maxKeyIDLen {
+			return h, fmt.Errorf("key id of %d bytes is too long", n)
+		}
+		keyID, err := read(int(n))
+		if err != nil {
+			return h, noEOF(err)
+		}
+		h.seal.keyID = string(keyID)
+		if h.seal.mac, err = read(sha256.Size); err != nil {
+			return h, noEOF(err)
+		}
+	}
+	return h, nil
+}
+
+type byteReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// oneByteReader reads the header of an envelope without reading ahead.
+type oneByteReader struct {
+	io.Reader
+}
+
+func (r oneByteReader) ReadByte() (byte, error) {
+	var b [1]byte
+	_, err := io.ReadFull(r, b[:])
+	return b[0], err
+}
+
+func (c Codec) writeBinary(buf *bytes.Buffer, op envelope) error {
+	id, ok := c.Unmarshal.ID(op.T)
+	if !ok {
+		return fmt.Errorf("%s has no type id", op.T)
+	}
+	data := op.Data
+	if op.D != nil {
+		scratch := buffers.GetInstance().GetBuffer()
+		defer buffers.GetInstance().PutBuffer(scratch)
+		if err := op.writeData(c.dataDriver(), scratch); err != nil {
+			return err
+		}
+		data = scratch.Bytes()
+	}
+
+	var sl seal
+	if sealer := c.sealer(); sealer != nil {
+		var err error
+		if sl, err = sealer(op, data); err != nil {
+			return err
+		}
+		if len(sl.keyID) > maxKeyIDLen {
+			return fmt.Errorf("key id of %d bytes is too long", len(sl.keyID))
+		}
+	}
+
+	var flags uint64
+	if op.V > 1 {
+		flags |= flagVersion
+	}
+	if sl.digest != nil {
+		flags |= flagDigest
+	}
+	if sl.mac != nil {
+		flags |= flagSignature
+	}
+	var header [6*binary.MaxVarintLen64 + sha256.Size + maxKeyIDLen + sha256.Size]byte
+	h := binary.AppendUvarint(header[:0], id)
+	h = binary.AppendUvarint(h, flags)
+	if flags&flagVersion != 0 {
+		h = binary.AppendUvarint(h, uint64(op.V))
+	}
+	if flags&flagDigest != 0 {
+		h = binary.AppendUvarint(h, uint64(sl.sum))
+		h = append(h, sl.digest...)
+	}
+	if flags&flagSignature != 0 {
+		h = binary.AppendUvarint(h, uint64(len(sl.keyID)))
+		h = append(h, sl.keyID...)
+		h = append(h, sl.mac...)
+	}
+	h = binary.AppendUvarint(h, uint64(len(data)))
+	buf.Write(h)
+	buf.Write(data)
+	return nil
+}
+
+// binaryEnvelope resolves the type id of a binary envelope. Errors are of type
+// *DecodeError.
+func (c Codec) binaryEnvelope(h binaryHeader, data []byte) (envelope, error) {
+	if h.flags&^knownFlags != 0 {
+		return envelope{}, newDecodeErr(ErrMalformedEnvelope, "", fmt.Errorf("unsupported flags %#x", h.flags))
+	}
+	if h.flags&flagVersion != 0 && (h.version < 1 || h.version > math.MaxInt32) {
+		return envelope{}, newDecodeErr(ErrMalformedEnvelope, "", fmt.Errorf("invalid envelope version %d", h.version))
+	}
+	t, ok := c.Unmarshal.TypeByID(h.id)
+	if !ok {
+		return envelope{}, newDecodeErr(ErrUnknownType, "", fmt.Errorf("type id %d", h.id))
+	}
+	return envelope{T: t, V: int(h.version), Data: data, schema: c.wire(), driver: c.dataDriver(), seal: h.seal}, nil
+}
+
+// parseBinary reads the header of the binary envelope raw, and returns its data.
+func parseBinary(raw []byte) (h binaryHeader, data []byte, err error) {
+	next := func() (uint64, error) {
+		v, n := binary.Uvarint(raw)
+		if n <= 0 {
+			return 0, io.ErrUnexpectedEOF
+		}
+		raw = raw[n:]
+		return v, nil
+	}
+	read := func(n int) ([]byte, error) {
+		if n > len(raw) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		b := raw[:n:n]
+		raw = raw[n:]
+		return b, nil
+	}
+	if h, err = readBinaryHeader(next, read); err != nil {
+		return h, nil, err
+	}
+	size, err := next()
+	switch {
+	case err != nil:
+		return h, nil, err
+	case size > uint64(len(raw)):
+		return h, nil, io.ErrUnexpectedEOF
+	case size < uint64(len(raw)):
+		return h, nil, errTrailingData
+	}
+	return h, raw, nil
+}
+
+// readBinary reads a binary envelope from r and writes its data to buf. It
+// returns io.EOF only if r ends before the envelope.
+func readBinary(r byteReader, buf *bytes.Buffer) (h binaryHeader, err error) {
+	next := func() (uint64, error) { return binary.ReadUvarint(r) }
+	read := func(n int) ([]byte, error) {
+		b := make([]byte, n)
+		_, err := io.ReadFull(r, b)
+		return b, err
+	}
+	if h, err = readBinaryHeader(next, read); err != nil {
+		return h, err
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil {
+		return h, noEOF(err)
+	}
+	// Copy rather than allocate size bytes upfront, which might be bogus.
+	if size > 1<<63-1 {
+		return h, fmt.Errorf("data of %d bytes is too large", size)
+	}
+	if _, err = io.CopyN(buf, r, int64(size)); err != nil {
+		return h, noEOF(err)
+	}
+	return h, nil
+}
+
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -0,0 +1,170 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newBinaryTestCodec(t *testing.T) Codec {
+	t.Helper()
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterID(TypeOf[TestPayload](), 7); err != nil {
+		t.Fatal(err)
+	}
+	return NewCodec(reg, WithSchema(SchemaBinary))
+}
+
+func TestRegistry_RegisterID(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.RegisterID("__codec.Test", 7); err != nil {
+		t.Fatalf("RegisterID() error = %v", err)
+	}
+	if err := reg.RegisterID("__codec.Test", 7); err != nil {
+		t.Errorf("RegisterID() again error = %v", err)
+	}
+	if err := reg.RegisterID("__codec.Test", 8); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("RegisterID() error = %v, wantErr %v", err, ErrDuplicateID)
+	}
+	if err := reg.RegisterID("__codec.Other", 7); !errors.Is(err, ErrDuplicateID) {
+		t.Errorf("RegisterID() error = %v, wantErr %v", err, ErrDuplicateID)
+	}
+	if id, ok := reg.ID("__codec.Test"); !ok || id != 7 {
+		t.Errorf("ID() = %v, %v, want 7, true", id, ok)
+	}
+	if typ, ok := reg.TypeByID(0); !ok || typ != "__codec.Error" {
+		t.Errorf("TypeByID() = %v, %v, want __codec.Error, true", typ, ok)
+	}
+	reg.Unregister("__codec.Test")
+	if _, ok := reg.TypeByID(7); ok {
+		t.Errorf("TypeByID() after Unregister() = _, true, want false")
+	}
+}
+
+func TestBinary_Marshal(t *testing.T) {
+	c := newBinaryTestCodec(t)
+	got, err := c.Marshal(&TestPayload{Data: "test"})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if want := "\x07\x00\x0f{\"Data\":\"test\"}"; string(got) != want {
+		t.Errorf("Marshal() = %q, want %q", got, want)
+	}
+
+	if _, err := c.Marshal(&TestEmptyPayload{}); err == nil {
+		t.Errorf("Marshal() of a type without id error = nil")
+	}
+}
+
+func TestBinary_Decode(t *testing.T) {
+	tests := []struct {
+		name    string
+		r       any
+		want    Data
+		wantErr error
+	}{
+		{name: "Bytes", r: []byte("\x07\x00\x0f{\"Data\":\"test\"}"), want: &TestPayload{Data: "test"}},
+		{name: "Reader", r: readerAt{strings.NewReader("\x07\x00\x0f{\"Data\":\"test\"}")}, want: &TestPayload{Data: "test"}},
+		{name: "Empty", r: []byte("\x07\x00\x00"), want: &TestPayload{}},
+		{name: "UnknownID", r: []byte("\x08\x00\x02{}"), wantErr: ErrUnknownType},
+		{name: "Flags", r: []byte("\x07\x01\x02{}"), wantErr: ErrMalformedEnvelope},
+		{name: "Short", r: []byte("\x07\x00\x0f{}"), wantErr: ErrMalformedEnvelope},
+		{name: "ShortReader", r: bytes.NewBufferString("\x07\x00\x0f{}"), wantErr: ErrMalformedEnvelope},
+		{name: "Trailing", r: []byte("\x07\x00\x02{}{}"), wantErr: ErrMalformedEnvelope},
+		{name: "Body", r: []byte("\x07\x00\x0b{\"Data\":42}"), wantErr: ErrBodyDecode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newBinaryTestCodec(t).Decode(tt.r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got.D, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got.D, tt.want)
+			}
+		})
+	}
+}
+
+func TestBinary_Decoder(t *testing.T) {
+	c := newBinaryTestCodec(t)
+	w := &bytes.Buffer{}
+	e := c.NewEncoder(w, WithFraming(Array))
+	for _, s := range []string{"a", "b"} {
+		if err := e.Encode(&TestPayload{Data: s}); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	w.WriteString("\x08\x00\x02{}\x07\x00\x0c{\"Data\":\"c\"}\x07\x00")
+
+	tests := []struct {
+		want       Data
+		wantErr    error
+		wantOffset int64
+	}{
+		{want: &TestPayload{Data: "a"}, wantOffset: 0},
+		{want: &TestPayload{Data: "b"}, wantOffset: 15},
+		{wantErr: ErrUnknownType, wantOffset: 30},
+		{want: &TestPayload{Data: "c"}, wantOffset: 35},
+		{wantErr: ErrMalformedEnvelope, wantOffset: 50},
+		{wantErr: ErrMalformedEnvelope, wantOffset: 50},
+	}
+	d := c.NewDecoder(w)
+	for i, tt := range tests {
+		got, err := d.Decode()
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("Decode() #%d error = %v, wantErr %v", i, err, tt.wantErr)
+		}
+		if err == nil && !reflect.DeepEqual(got.D, tt.want) {
+			t.Errorf("Decode() #%d = %v, want %v", i, got.D, tt.want)
+		}
+		if err == nil && d.Offset() != tt.wantOffset {
+			t.Errorf("Offset() #%d = %d, want %d", i, d.Offset(), tt.wantOffset)
+		}
+		var de *DecodeError
+		if errors.As(err, &de) && de.Offset != tt.wantOffset {
+			t.Errorf("Decode() #%d error offset = %d, want %d", i, de.Offset, tt.wantOffset)
+		}
+	}
+
+	d = c.NewDecoder(bytes.NewReader(nil))
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestTranscode(t *testing.T) {
+	binaryCodec := newBinaryTestCodec(t)
+	jsonCodec := NewCodec(nil, WithSchema(SchemaV2))
+	const ndjson = "{\"type\":\"__codec.Test\",\"data\":{\"Data\":\"a\"}}\n" +
+		"{\"type\":\"__codec.Test\",\"data\":{\"Data\":\"b\"}}\n"
+
+	bin := &bytes.Buffer{}
+	if err := Transcode(bin, bytes.NewBufferString(ndjson), jsonCodec, binaryCodec); err != nil {
+		t.Fatalf("Transcode() error = %v", err)
+	}
+	if want := "\x07\x00\x0c{\"Data\":\"a\"}\x07\x00\x0c{\"Data\":\"b\"}"; bin.String() != want {
+		t.Errorf("Transcode() = %q, want %q", bin.String(), want)
+	}
+
+	got := &bytes.Buffer{}
+	if err := Transcode(got, bin, binaryCodec, jsonCodec); err != nil {
+		t.Fatalf("Transcode() error = %v", err)
+	}
+	if got.String() != ndjson {
+		t.Errorf("Transcode() = %q, want %q", got.String(), ndjson)
+	}
+
+	if err := Transcode(io.Discard, bytes.NewBufferString("\x09\x00\x00"), binaryCodec, jsonCodec); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Transcode() error = %v, wantErr %v", err, ErrUnknownType)
+	}
+}
@@ -1,36 +1,197 @@
 package codec
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"x/buffers"
+	"x/encoding"
 	"x/json"
 )
 
 type Codec struct {
-	Unmarshal unmarshal
+	Unmarshal *Registry
+
+	schema Schema
+	driver json.Driver
+	// aliases are the names types are written with instead of their own.
+	aliases map[CType]CType
+	unknown UnknownFunc
+	limits  Limits
+	strict  bool
+	// checksum seals the envelopes written, keyID and key sign them if signed,
+	// keys verifies them.
+	checksum Checksum
+	signed   bool
+	keyID    string
+	key      []byte
+	keys     KeyFunc
+}
+
+type Option func(*Codec)
+
+// WithSchema sets the Schema envelopes are written with, SchemaV1 by default.
+func WithSchema(s Schema) Option {
+	return func(c *Codec) {
+		c.schema = s
+	}
+}
+
+// WithDriver sets the driver used to encode and decode envelopes, instead of
+// json.Default. Besides the JSON drivers, this can be any encoding.Driver, such
+// as cbor.Driver or msgpack.Driver, in which case the envelopes are written in
+// that format with the keys of the Schema.
+func WithDriver(d json.Driver) Option {
+	return func(c *Codec) {
+		c.driver = d
+	}
+}
+
+// WithTypeAlias writes envelopes of t with the type alias instead, e.g. to keep
+// emitting the old name of a renamed type until all readers know the new one.
+// Binary envelopes are not affected, as aliases share the type id of their
+// type.
+func WithTypeAlias(t, alias CType) Option {
+	return func(c *Codec) {
+		aliases := make(map[CType]CType, len(c.aliases)+1)
+		for k, v := range c.aliases {
+			aliases[k] = v
+		}
+		aliases[t] = alias
+		c.aliases = aliases
+	}
 }
 
-func NewCodec(u unmarshal) Codec {
-	return Codec{Unmarshal: u}
+// WithStrict makes the Codec reject envelopes with keys that are not part of the
+// Schema, data with keys that don't match any field of the struct it is decoded
+// into, duplicate keys and data after an envelope read from an io.Reader. The
+// errors are of type *json.StrictError, with the path of the offending element.
+// Data is only checked if it is JSON.
+func WithStrict() Option {
+	return func(c *Codec) {
+		c.strict = true
+	}
 }
 
-type codecPayload struct {
-	Payload
-	Data json.Raw
+func NewCodec(u *Registry, opts ...Option) Codec {
+	c := Codec{Unmarshal: u}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.strict && isJSON(c.dataDriver()) {
+		c.driver = json.StrictWith(c.dataDriver())
+	}
+	if c.limits != (Limits{}) {
+		c.driver = c.limitDriver()
+	}
+	return c
 }
 
+func (c Codec) dataDriver() json.Driver {
+	if c.driver == nil {
+		return json.Default
+	}
+	return c.driver
+}
+
+// textual reports whether envelopes are JSON text. Otherwise they are
+// self-delimiting and written back to back.
+func (c Codec) textual() bool {
+	return c.wire().Layout != Binary && isJSON(c.dataDriver())
+}
+
+func isJSON(d json.Driver) bool {
+	return encoding.ContentType(d) == json.ContentType
+}
+
+func (c Codec) wire() Schema {
+	if c.schema == (Schema{}) {
+		return SchemaV1
+	}
+	return c.schema
+}
+
+// ErrorPayload carries an error as Data. Encoded, it holds the message of the
+// error, with the errors it wraps as a chain of causes, so it can be sent to and
+// decoded by another process.
 type ErrorPayload struct {
+	Message string
+	// Code identifies the kind of error, errors.Is matches ErrorPayloads by it.
+	Code string
+	// Details holds any further information as JSON.
+	Details json.Raw
+	Cause   *ErrorPayload
+
 	err error
 }
 
+// NewErrorPayload returns an ErrorPayload carrying err with code.
+func NewErrorPayload(err error, code string) *ErrorPayload {
+	return &ErrorPayload{Code: code, err: err}
+}
+
 func (p *ErrorPayload) Error() string {
-	return p.err.Error()
+	if p.err != nil {
+		return p.err.Error()
+	}
+	return p.Message
 }
 
 func (p *ErrorPayload) Unwrap() error {
-	return p.err
+	if p.err != nil {
+		return p.err
+	}
+	if p.Cause != nil {
+		return p.Cause
+	}
+	return nil
+}
+
+func (p *ErrorPayload) Is(target error) bool {
+	t, ok := target.(*ErrorPayload)
+	return ok && t.Code != "" && t.Code == p.Code
+}
+
+type errorPayloadJSON struct {
+	Message string        `json:"message"`
+	Code    string        `json:"code,omitempty"`
+	Details json.Raw      `json:"details,omitempty"`
+	Cause   *ErrorPayload `json:"cause,omitempty"`
+}
+
+func (p *ErrorPayload) MarshalJSON() ([]byte, error) {
+	w := errorPayloadJSON{
+		Message: p.Error(),
+		Code:    p.Code,
+		Details: p.Details,
+		Cause:   p.Cause,
+	}
+	if w.Cause == nil && p.err != nil {
+		if err := errors.Unwrap(p.err); err != nil {
+			var ok bool
+			if w.Cause, ok = err.(*ErrorPayload); !ok {
+				w.Cause = &ErrorPayload{err: err}
+			}
+		}
+	}
+	return json.Marshal(w)
+}
+
+func (p *ErrorPayload) UnmarshalJSON(b []byte) error {
+	var w errorPayloadJSON
+	if err := json.Unmarshal(b, &w); err != nil {
+		return err
+	}
+	*p = ErrorPayload{
+		Message: w.Message,
+		Code:    w.Code,
+		Details: w.Details,
+		Cause:   w.Cause,
+	}
+	return nil
 }
 
 func (*ErrorPayload) Type() CType {
@@ -49,51 +210,160 @@ func newCodecErr(err error, wrap string) Payload {
 	}
 }
 
+// DecodeFrom decodes an envelope like Decode, but reports errors as a Payload
+// holding an ErrorPayload.
 func (c Codec) DecodeFrom(r any) Payload {
-	var op codecPayload
-	buffer := buffers.GetInstance().GetBytes()
-	op.Data = buffer
-	defer buffers.GetInstance().PutBytes(buffer)
+	p, err := c.Decode(r)
+	if err != nil {
+		return newCodecErr(err, "")
+	}
+	return p
+}
 
+// Decode decodes an envelope from r, which is one of
+//   - []byte, json.Raw, string or bytes.Buffer holding the envelope,
+//   - a Source, which is opened and closed again,
+//   - an io.Reader, such as an fs.File, the envelope is read from,
+//   - an io.ReaderAt with a Size method, such as a *bytes.Reader.
+//
+// Errors are of type *DecodeError.
+func (c Codec) Decode(r any) (Payload, error) {
+	return c.decode(r, c.payload)
+}
+
+// decode reads an envelope from r, see Decode, and turns it into a Payload with
+// fn.
+func (c Codec) decode(r any, fn func(envelope) (Payload, error)) (Payload, error) {
 	switch x := r.(type) {
-	case io.Reader:
-		if err := json.DecodeStream(x, &op); err != nil {
-			return newCodecErr(err, "cannot read JSON stream")
-		}
 	case []byte:
-		if err := json.Unmarshal(x, &op); err != nil {
-			return newCodecErr(err, "cannot read JSON stream")
+		return c.decodeEnvelope(x, fn)
+	case json.Raw:
+		return c.decodeEnvelope(x, fn)
+	case string:
+		return c.decodeEnvelope([]byte(x), fn)
+	case bytes.Buffer:
+		return c.decodeEnvelope(x.Bytes(), fn)
+	case Source:
+		rc, err := x.Open()
+		if err != nil {
+			return Payload{}, newDecodeErr(ErrOpenSource, "", err)
 		}
+		defer rc.Close()
+		return c.decodeReader(rc, fn)
+	case io.Reader:
+		return c.decodeReader(x, fn)
+	case sizedReaderAt:
+		return c.decodeReader(io.NewSectionReader(x, 0, x.Size()), fn)
 	default:
-		return newCodecErr(fmt.Errorf("unknown config"), "")
+		return Payload{}, newDecodeErr(ErrUnsupportedSource, "", nil)
 	}
+}
 
-	fn := c.Unmarshal.Lookup(op.T)
+func (c Codec) payload(op envelope) (Payload, error) {
+	t, fn := c.Unmarshal.resolve(op.T)
+	if fn == nil && c.unknown != nil {
+		return c.unknownPayload(op)
+	}
 	if fn == nil {
-		return newCodecErr(fmt.Errorf("configuration not defined for %s", op.T), "")
+		return Payload{}, newDecodeErr(ErrUnknownType, op.T, nil)
+	}
+	if t != op.T {
+		c.Unmarshal.aliased(op.T, t)
+	}
+	p := Payload{T: t, D: fn()}
+	// Leave p.D as created if there is no data.
+	if len(op.Data) > 0 {
+		if err := c.decodeData(t, op, p.D); err != nil {
+			return Payload{}, err
+		}
 	}
-	op.Payload.D = fn()
-	if err := op.Data.UnmarshalTo(op.Payload.D); err != nil {
-		return newCodecErr(err, "cannot read JSON data")
+	if err := c.Unmarshal.validate(p.D); err != nil {
+		return Payload{}, newDecodeErr(ErrValidation, t, err)
 	}
-	return op.Payload
+	return p, nil
 }
 
-func EncodeTo(w any, payload Data) (err error) {
-	op := new(codecPayload)
-	op.T = payload.Type()
-	marshal, err := json.Marshal(payload)
-	if err != nil {
-		return err
+// decodeData migrates the data of op, of type t, to the version of d and
+// decodes it into d.
+func (c Codec) decodeData(t CType, op envelope, d Data) error {
+	data := op.Data
+	if c.strict && op.schema.Layout == Inline {
+		// The keys of the envelope are no fields of d.
+		var err error
+		if data, err = op.schema.inlineData(c.dataDriver(), data); err != nil {
+			return newDecodeErr(ErrBodyDecode, t, err)
+		}
+	}
+	if v := versionOf(d); op.version() != v {
+		var err error
+		if data, err = c.Unmarshal.migrate(c.dataDriver(), t, op.version(), v, data); err != nil {
+			return newDecodeErr(ErrMigration, t, err)
+		}
 	}
-	_ = op.Data.UnmarshalJSON(marshal)
+	if err := c.dataDriver().Unmarshal(data, d); err != nil {
+		var se *json.StrictError
+		if errors.As(err, &se) && op.schema.Layout == Wrapped {
+			se.Path = "$." + op.schema.Data + strings.TrimPrefix(se.Path, "$")
+		}
+		return newDecodeErr(ErrBodyDecode, t, err)
+	}
+	return nil
+}
+
+// Marshal returns the envelope of payload, written with SchemaV1.
+func Marshal(payload Data) ([]byte, error) {
+	return Codec{}.Marshal(payload)
+}
+
+// AppendTo appends the envelope of payload, written with SchemaV1, to dst and
+// returns the extended slice.
+func AppendTo(dst []byte, payload Data) ([]byte, error) {
+	return Codec{}.AppendTo(dst, payload)
+}
+
+// EncodeTo writes the envelope of payload, written with SchemaV1, to w, which
+// is either an io.Writer or a *[]byte the envelope is appended to.
+func EncodeTo(w any, payload Data) error {
+	return Codec{}.EncodeTo(w, payload)
+}
+
+// Marshal returns the envelope of payload.
+func (c Codec) Marshal(payload Data) ([]byte, error) {
+	return c.AppendTo(nil, payload)
+}
+
+// AppendTo appends the envelope of payload to dst and returns the extended
+// slice.
+func (c Codec) AppendTo(dst []byte, payload Data) ([]byte, error) {
+	buf := bytes.NewBuffer(dst)
+	if err := c.writeEnvelope(buf, newEnvelope(payload)); err != nil {
+		return dst, err
+	}
+	return buf.Bytes(), nil
+}
+
+// EncodeTo writes the envelope of payload to w, which is either an io.Writer or
+// a *[]byte the envelope is appended to. JSON envelopes written to an io.Writer
+// are terminated by a newline.
+func (c Codec) EncodeTo(w any, payload Data) (err error) {
 	switch x := w.(type) {
-	case []byte:
-		x, err = json.Marshal(op)
 	case io.Writer:
-		err = json.EncodeStream(x, op)
+		buf := buffers.GetInstance().GetBuffer()
+		defer buffers.GetInstance().PutBuffer(buf)
+		if err := c.writeEnvelope(buf, newEnvelope(payload)); err != nil {
+			return err
+		}
+		if c.textual() {
+			buf.WriteByte('\n')
+		}
+		_, err = buf.WriteTo(x)
+		return err
+	case *[]byte:
+		*x, err = c.AppendTo(*x, payload)
+		return err
+	case []byte:
+		return fmt.Errorf("%T not supported, use Marshal, AppendTo or a *[]byte", w)
 	default:
 		return fmt.Errorf("%T not supported", w)
 	}
-	return err
 }
@@ -2,9 +2,16 @@ package codec
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"testing"
+
+	"x/encoding"
+	"x/encoding/cbor"
+	"x/encoding/msgpack"
+	"x/json"
 )
 
 type TestUndefinedPayload struct {
@@ -25,7 +32,7 @@ func (t *TestPayload) Type() CType {
 
 func TestCodec_DecodeFrom(t *testing.T) {
 	type fields struct {
-		Unmarshal unmarshal
+		Unmarshal *Registry
 	}
 	type args struct {
 		r any
@@ -35,6 +42,9 @@ func TestCodec_DecodeFrom(t *testing.T) {
 		fields fields
 		args   args
 		want   Data
+		// wantKind matches the error by its kind, leaving the message to the
+		// JSON driver.
+		wantKind error
 	}{
 		{
 			name: "DecodeFrom",
@@ -64,7 +74,8 @@ func TestCodec_DecodeFrom(t *testing.T) {
 			args: args{
 				r: []byte("{\"T\":\"__codec.Test\",\"D\":null,\"Data\":{\"Data\":\"test\"}"),
 			},
-			want: &ErrorPayload{err: fmt.Errorf("cannot read JSON stream: expected comma after object element")},
+			want:     &ErrorPayload{},
+			wantKind: ErrMalformedEnvelope,
 		},
 		{
 			name: "DecodeFromErrDefault",
@@ -72,10 +83,20 @@ func TestCodec_DecodeFrom(t *testing.T) {
 				Unmarshal: NewUnmarshal(func() Data { return new(TestPayload) }),
 			},
 			args: args{
-				r: "{\"T\":\"__codec.Test\",\"D\":null,\"Data\":{\"Data\":\"test\"}",
+				r: 42,
 			},
 			want: &ErrorPayload{err: fmt.Errorf("unknown config")},
 		},
+		{
+			name: "DecodeFromString",
+			fields: fields{
+				Unmarshal: NewUnmarshal(func() Data { return new(TestPayload) }),
+			},
+			args: args{
+				r: "{\"T\":\"__codec.Test\",\"D\":null,\"Data\":{\"Data\":\"test\"}}",
+			},
+			want: &TestPayload{Data: "test"},
+		},
 		{
 			name: "DecodeFromIO",
 			fields: fields{
@@ -94,7 +115,8 @@ func TestCodec_DecodeFrom(t *testing.T) {
 			args: args{
 				r: bytes.NewBufferString("{\"T\":\"__codec.Test\",\"D\":null,\"Data\":{\"Data\":\"test\"}"),
 			},
-			want: &ErrorPayload{err: fmt.Errorf("cannot read JSON stream: expected comma after object element")},
+			want:     &ErrorPayload{},
+			wantKind: ErrMalformedEnvelope,
 		},
 		{
 			name: "DecodeFromInternal",
@@ -120,9 +142,13 @@ func TestCodec_DecodeFrom(t *testing.T) {
 			case *ErrorPayload:
 				e, ok := got.D.(*ErrorPayload)
 				if !ok {
-					t.Errorf("DecodeFrom() = %T, want %T", got.D, tt.want)
+					t.Fatalf("DecodeFrom() = %T, want %T", got.D, tt.want)
 				}
-				if e.Error() != tt.want.(*ErrorPayload).Error() {
+				if tt.wantKind != nil {
+					if !errors.Is(e, tt.wantKind) {
+						t.Errorf("DecodeFrom() = %v, want %v", e, tt.wantKind)
+					}
+				} else if e.Error() != tt.want.(*ErrorPayload).Error() {
 					t.Errorf("DecodeFrom() = %v, want %v", got.D.(*ErrorPayload).Error(), tt.want.(*ErrorPayload).Error())
 				}
 			}
@@ -131,6 +157,71 @@ func TestCodec_DecodeFrom(t *testing.T) {
 	}
 }
 
+func TestCodec_Decode(t *testing.T) {
+	tests := []struct {
+		name     string
+		r        any
+		want     Data
+		wantErr  error
+		wantType CType
+	}{
+		{
+			name: "Decode",
+			r:    []byte("{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"),
+			want: &TestPayload{Data: "test"},
+		},
+		{
+			name:     "DecodeUnknownType",
+			r:        []byte("{\"T\":\"__codec.TestUndefined\",\"Data\":{\"Data\":\"test\"}}"),
+			wantErr:  ErrUnknownType,
+			wantType: "__codec.TestUndefined",
+		},
+		{
+			name:    "DecodeMalformedEnvelope",
+			r:       []byte("{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}"),
+			wantErr: ErrMalformedEnvelope,
+		},
+		{
+			name:    "DecodeMissingType",
+			r:       bytes.NewBufferString("{\"Data\":{\"Data\":\"test\"}}"),
+			wantErr: ErrMalformedEnvelope,
+		},
+		{
+			name:     "DecodeBody",
+			r:        bytes.NewBufferString("{\"T\":\"__codec.Test\",\"Data\":{\"Data\":1}}"),
+			wantErr:  ErrBodyDecode,
+			wantType: "__codec.Test",
+		},
+		{
+			name:    "DecodeUnsupportedSource",
+			r:       42,
+			wantErr: ErrUnsupportedSource,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }))
+			got, err := c.Decode(tt.r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				var de *DecodeError
+				if !errors.As(err, &de) {
+					t.Fatalf("Decode() error = %T, want %T", err, de)
+				}
+				if de.Type != tt.wantType {
+					t.Errorf("Decode() error type = %v, want %v", de.Type, tt.wantType)
+				}
+				return
+			}
+			if !reflect.DeepEqual(got.D, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got.D, tt.want)
+			}
+		})
+	}
+}
+
 type syntaxError interface {
 	Is(err error) bool
 }
@@ -167,6 +258,14 @@ func TestEncodeTo(t *testing.T) {
 				w:       []byte{},
 				payload: &TestPayload{Data: "test"},
 			},
+			wantErr: true,
+		},
+		{
+			name: "EncodeToBytePtr",
+			args: args{
+				w:       new([]byte),
+				payload: &TestPayload{Data: "test"},
+			},
 			wantErr: false,
 		},
 	}
@@ -179,6 +278,61 @@ func TestEncodeTo(t *testing.T) {
 	}
 }
 
+func TestEncodeTo_BytePtr(t *testing.T) {
+	const want = "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"
+	b := []byte("prefix")
+	if err := EncodeTo(&b, &TestPayload{Data: "test"}); err != nil {
+		t.Fatalf("EncodeTo() error = %v", err)
+	}
+	if got := string(b); got != "prefix"+want {
+		t.Errorf("EncodeTo() = %v, want %v", got, "prefix"+want)
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload Data
+		want    string
+	}{
+		{
+			name:    "Marshal",
+			payload: &TestPayload{Data: "test"},
+			want:    "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Marshal(tt.payload)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", got, tt.want)
+			}
+			c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }))
+			if p := c.DecodeFrom(got); !reflect.DeepEqual(p.D, tt.payload) {
+				t.Errorf("DecodeFrom(Marshal()) = %v, want %v", p.D, tt.payload)
+			}
+		})
+	}
+}
+
+func TestAppendTo(t *testing.T) {
+	const envelope = "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"
+	got, err := AppendTo([]byte("["), &TestPayload{Data: "test"})
+	if err != nil {
+		t.Fatalf("AppendTo() error = %v", err)
+	}
+	got, err = AppendTo(append(got, ','), &TestPayload{Data: "test"})
+	if err != nil {
+		t.Fatalf("AppendTo() error = %v", err)
+	}
+	if want := "[" + envelope + "," + envelope; string(got) != want {
+		t.Errorf("AppendTo() = %s, want %s", got, want)
+	}
+}
+
 func TestErrorPayload_Error(t *testing.T) {
 	type fields struct {
 		err error
@@ -208,6 +362,82 @@ func TestErrorPayload_Error(t *testing.T) {
 	}
 }
 
+func TestErrorPayload_RoundTrip(t *testing.T) {
+	base := fmt.Errorf("disk full")
+	tests := []struct {
+		name        string
+		payload     *ErrorPayload
+		wantJSON    string
+		wantMessage string
+		wantChain   []string
+	}{
+		{
+			name:        "Message",
+			payload:     NewErrorPayload(base, ""),
+			wantJSON:    "{\"T\":\"__codec.Error\",\"Data\":{\"message\":\"disk full\"}}",
+			wantMessage: "disk full",
+			wantChain:   []string{"disk full"},
+		},
+		{
+			name:        "Chain",
+			payload:     NewErrorPayload(fmt.Errorf("save: %w", fmt.Errorf("write: %w", base)), "io"),
+			wantJSON:    "{\"T\":\"__codec.Error\",\"Data\":{\"message\":\"save: write: disk full\",\"code\":\"io\",\"cause\":{\"message\":\"write: disk full\",\"cause\":{\"message\":\"disk full\"}}}}",
+			wantMessage: "save: write: disk full",
+			wantChain:   []string{"save: write: disk full", "write: disk full", "disk full"},
+		},
+		{
+			name: "Details",
+			payload: &ErrorPayload{
+				Message: "invalid order",
+				Code:    "validation",
+				Details: json.Raw(`{"field":"amount"}`),
+			},
+			wantJSON:    "{\"T\":\"__codec.Error\",\"Data\":{\"message\":\"invalid order\",\"code\":\"validation\",\"details\":{\"field\":\"amount\"}}}",
+			wantMessage: "invalid order",
+			wantChain:   []string{"invalid order"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := Marshal(tt.payload)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(b) != tt.wantJSON {
+				t.Errorf("Marshal() = %s, want %s", b, tt.wantJSON)
+			}
+
+			p, err := NewCodec(NewRegistry()).Decode(b)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			got, ok := p.D.(*ErrorPayload)
+			if !ok {
+				t.Fatalf("Decode() = %T, want %T", p.D, got)
+			}
+			if got.Error() != tt.wantMessage {
+				t.Errorf("Error() = %v, want %v", got.Error(), tt.wantMessage)
+			}
+			if got.Code != tt.payload.Code {
+				t.Errorf("Code = %v, want %v", got.Code, tt.payload.Code)
+			}
+			if tt.payload.Code != "" && !errors.Is(got, &ErrorPayload{Code: tt.payload.Code}) {
+				t.Errorf("errors.Is(%v) = false, want true", tt.payload.Code)
+			}
+			if !bytes.Equal(got.Details, tt.payload.Details) {
+				t.Errorf("Details = %s, want %s", got.Details, tt.payload.Details)
+			}
+			var chain []string
+			for err := error(got); err != nil; err = errors.Unwrap(err) {
+				chain = append(chain, err.Error())
+			}
+			if !reflect.DeepEqual(chain, tt.wantChain) {
+				t.Errorf("Unwrap() chain = %v, want %v", chain, tt.wantChain)
+			}
+		})
+	}
+}
+
 func TestErrorPayload_Type(t *testing.T) {
 	type fields struct {
 		err error
@@ -361,3 +591,142 @@ func Test_newCodecErr1(t *testing.T) {
 		})
 	}
 }
+
+// encodeToDoubleEncoding is the previous EncodeTo implementation, which
+// marshals the payload and then the envelope around it, kept for comparison.
+func encodeToDoubleEncoding(w io.Writer, payload Data) error {
+	op := new(struct {
+		Payload
+		Data json.Raw
+	})
+	op.T = payload.Type()
+	marshal, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_ = op.Data.UnmarshalJSON(marshal)
+	return json.EncodeStream(w, op)
+}
+
+func BenchmarkEncodeTo(b *testing.B) {
+	payload := &TestPayload{Data: "test"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := EncodeTo(io.Discard, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeToDoubleEncoding(b *testing.B) {
+	payload := &TestPayload{Data: "test"}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if err := encodeToDoubleEncoding(io.Discard, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendTo(b *testing.B) {
+	payload := &TestPayload{Data: "test"}
+	buf := make([]byte, 0, 1<<10)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var err error
+		if buf, err = AppendTo(buf[:0], payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCodec_WithDriver(t *testing.T) {
+	const envelope = "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\",\"Unknown\":true}}"
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantErr error
+	}{
+		{name: "Default"},
+		{name: "Std", opts: []Option{WithDriver(json.Std())}},
+		{name: "Strict", opts: []Option{WithDriver(json.Strict())}, wantErr: ErrBodyDecode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }), tt.opts...)
+			for _, r := range []any{[]byte(envelope), bytes.NewBufferString(envelope)} {
+				if _, err := c.Decode(r); !errors.Is(err, tt.wantErr) {
+					t.Errorf("Decode(%T) error = %v, wantErr %v", r, err, tt.wantErr)
+				}
+			}
+			b, err := c.Marshal(&TestPayload{Data: "test"})
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if want := "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"; string(b) != want {
+				t.Errorf("Marshal() = %s, want %s", b, want)
+			}
+		})
+	}
+	if _, ok := json.Default.(json.DefaultDriver); !ok {
+		t.Errorf("json.Default = %T, want %T", json.Default, json.DefaultDriver{})
+	}
+}
+
+func TestCodec_Formats(t *testing.T) {
+	drivers := []json.Driver{cbor.Driver{}, msgpack.Driver{}}
+	schemas := []Schema{SchemaV1, SchemaV2, SchemaInline, SchemaBinary}
+	for _, d := range drivers {
+		for _, s := range schemas {
+			t.Run(fmt.Sprintf("%s/%v", encoding.ContentType(d), s), func(t *testing.T) {
+				c := newBinaryTestCodec(t)
+				c = NewCodec(c.Unmarshal, WithDriver(d), WithSchema(s))
+				payloads := []Data{
+					&TestPayload{Data: "test"},
+					NewErrorPayload(fmt.Errorf("wrapped: %w", io.EOF), "eof"),
+				}
+
+				var stream []byte
+				for _, p := range payloads {
+					b, err := c.Marshal(p)
+					if err != nil {
+						t.Fatalf("Marshal() error = %v", err)
+					}
+					got, err := c.Decode(b)
+					if err != nil {
+						t.Fatalf("Decode() error = %v", err)
+					}
+					if got.T != p.Type() {
+						t.Errorf("Decode() = %s, want %s", got.T, p.Type())
+					}
+					stream = append(stream, b...)
+				}
+
+				buf := &bytes.Buffer{}
+				e := c.NewEncoder(buf)
+				for _, p := range payloads {
+					if err := e.Encode(p); err != nil {
+						t.Fatalf("Encode() error = %v", err)
+					}
+				}
+				if !bytes.Equal(buf.Bytes(), stream) {
+					t.Errorf("Encode() = %x, want %x", buf.Bytes(), stream)
+				}
+
+				dec := c.NewDecoder(buf)
+				for i := 0; dec.Next(); i++ {
+					p := dec.Payload()
+					if i == 0 && !reflect.DeepEqual(p.D, payloads[0]) {
+						t.Errorf("Payload() = %v, want %v", p.D, payloads[0])
+					}
+					if i == 1 && (p.D.(*ErrorPayload).Error() != "wrapped: EOF" || !errors.Is(p.D.(error), &ErrorPayload{Code: "eof"})) {
+						t.Errorf("Payload() = %v, want %v", p.D, payloads[1])
+					}
+				}
+				if err := dec.Err(); err != nil {
+					t.Errorf("Err() = %v", err)
+				}
+			})
+		}
+	}
+}
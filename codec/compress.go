@@ -0,0 +1,160 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+
+	"x/buffers"
+)
+
+// Compression selects how a stream of envelopes is compressed.
+type Compression uint8
+
+const (
+	NoCompression Compression = iota
+	// Gzip is the gzip format of RFC 1952.
+	Gzip
+	// Zlib is the zlib format of RFC 1950.
+	Zlib
+	// Flate is raw DEFLATE data of RFC 1951, which can't be detected.
+	Flate
+)
+
+// WithCompression compresses the output of the Encoder with c. Compressed data
+// is written out whenever the Encoder flushes, see WithBuffer, and the stream
+// is only complete once the Encoder is closed.
+func WithCompression(c Compression) EncoderOption {
+	return func(e *Encoder) {
+		e.compression = c
+	}
+}
+
+type DecoderOption func(*Decoder)
+
+// WithDecompression makes the Decoder read input compressed with c. By default
+// gzip and zlib input is detected by its magic bytes, NoCompression turns that
+// off.
+func WithDecompression(c Compression) DecoderOption {
+	return func(d *Decoder) {
+		d.compression = c
+		d.detect = false
+	}
+}
+
+// compressor compresses to a scratch buffer from the pool, which is written to
+// w when flushing.
+type compressor struct {
+	w io.Writer
+	z interface {
+		io.WriteCloser
+		Flush() error
+	}
+	buf *bytes.Buffer
+}
+
+func newCompressor(c Compression, w io.Writer) (*compressor, error) {
+	z := &compressor{w: w, buf: buffers.GetInstance().GetBuffer()}
+	switch c {
+	case Gzip:
+		z.z = gzip.NewWriter(z.buf)
+	case Zlib:
+		z.z = zlib.NewWriter(z.buf)
+	case Flate:
+		// Only invalid levels are errors.
+		z.z, _ = flate.NewWriter(z.buf, flate.DefaultCompression)
+	default:
+		buffers.GetInstance().PutBuffer(z.buf)
+		return nil, fmt.Errorf("unknown compression %d", c)
+	}
+	return z, nil
+}
+
+// flush compresses b and writes out everything compressed so far.
+func (z *compressor) flush(b *bytes.Buffer) error {
+	if _, err := b.WriteTo(z.z); err != nil {
+		return err
+	}
+	if err := z.z.Flush(); err != nil {
+		return err
+	}
+	_, err := z.buf.WriteTo(z.w)
+	return err
+}
+
+// close compresses b, terminates the compressed stream and releases the
+// scratch buffer.
+func (z *compressor) close(b *bytes.Buffer) error {
+	defer buffers.GetInstance().PutBuffer(z.buf)
+	if _, err := b.WriteTo(z.z); err != nil {
+		return err
+	}
+	if err := z.z.Close(); err != nil {
+		return err
+	}
+	_, err := z.buf.WriteTo(z.w)
+	return err
+}
+
+// decompressReader decompresses r. It only starts reading r when it is read
+// from, unlike the gzip and zlib readers, which read their headers right away.
+type decompressReader struct {
+	r      io.Reader
+	c      Compression
+	detect bool
+	// binary excludes zlib from detection, as its magic bytes are a valid
+	// Binary envelope header.
+	binary bool
+	zr     io.Reader
+	err    error
+}
+
+func (r *decompressReader) Read(p []byte) (int, error) {
+	if r.zr == nil && r.err == nil {
+		r.zr, r.err = r.open()
+	}
+	if r.err != nil {
+		return 0, r.err
+	}
+	return r.zr.Read(p)
+}
+
+func (r *decompressReader) open() (io.Reader, error) {
+	c := r.c
+	src := r.r
+	if r.detect {
+		br := bufio.NewReader(r.r)
+		c = r.sniff(br)
+		src = br
+	}
+	switch c {
+	case NoCompression:
+		return src, nil
+	case Gzip:
+		return gzip.NewReader(src)
+	case Zlib:
+		return zlib.NewReader(src)
+	case Flate:
+		return flate.NewReader(src), nil
+	}
+	return nil, fmt.Errorf("unknown compression %d", c)
+}
+
+// sniff detects the compression of br by its magic bytes.
+func (r *decompressReader) sniff(br *bufio.Reader) Compression {
+	b, _ := br.Peek(2)
+	switch {
+	case len(b) < 2:
+		return NoCompression
+	case b[0] == 0x1f && b[1] == 0x8b:
+		return Gzip
+	case !r.binary && b[0]&0x0f == 8 && b[0]>>4 <= 7 && (uint16(b[0])<<8|uint16(b[1]))%31 == 0:
+		// Deflate with a window of at most 32 KiB and a valid check value.
+		return Zlib
+	}
+	return NoCompression
+}
@@ -0,0 +1,82 @@
+package codec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncoder_WithCompression(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression Compression
+		schema      Schema
+		opts        []DecoderOption
+		wantMagic   []byte
+	}{
+		{name: "Gzip", compression: Gzip, wantMagic: []byte{0x1f, 0x8b}},
+		{name: "Zlib", compression: Zlib, wantMagic: []byte{0x78}},
+		{name: "Flate", compression: Flate, opts: []DecoderOption{WithDecompression(Flate)}},
+		{name: "GzipBinary", compression: Gzip, schema: SchemaBinary, wantMagic: []byte{0x1f, 0x8b}},
+		{name: "ZlibBinary", compression: Zlib, schema: SchemaBinary, opts: []DecoderOption{WithDecompression(Zlib)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newBinaryTestCodec(t)
+			c.schema = tt.schema
+			for _, size := range []int{0, 1 << 10} {
+				var buf bytes.Buffer
+				enc := c.NewEncoder(&buf, WithCompression(tt.compression), WithBuffer(size))
+				for i := 0; i < 100; i++ {
+					if err := enc.Encode(&TestPayload{Data: "repetitive"}); err != nil {
+						t.Fatalf("Encode() error = %v", err)
+					}
+				}
+				if err := enc.Close(); err != nil {
+					t.Fatalf("Close() error = %v", err)
+				}
+				if !bytes.HasPrefix(buf.Bytes(), tt.wantMagic) {
+					t.Errorf("output starts with %x, want %x", buf.Bytes()[:2], tt.wantMagic)
+				}
+
+				dec := c.NewDecoder(&buf, tt.opts...)
+				n := 0
+				for dec.Next() {
+					if p, ok := dec.Payload().D.(*TestPayload); !ok || p.Data != "repetitive" {
+						t.Fatalf("Payload() = %v", dec.Payload())
+					}
+					n++
+				}
+				if dec.Err() != nil || n != 100 {
+					t.Errorf("decoded %d envelopes, Err() = %v", n, dec.Err())
+				}
+			}
+		})
+	}
+}
+
+func TestDecoder_WithDecompression(t *testing.T) {
+	c := newBinaryTestCodec(t)
+	var buf bytes.Buffer
+	enc := c.NewEncoder(&buf, WithCompression(Gzip))
+	if err := enc.Encode(&TestPayload{Data: "test"}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	compressed := buf.Bytes()
+
+	if _, err := c.NewDecoder(bytes.NewReader(compressed), WithDecompression(NoCompression)).Decode(); err == nil {
+		t.Errorf("Decode() without decompression error = nil")
+	}
+	// The checksum is missing.
+	dec := c.NewDecoder(bytes.NewReader(compressed[:len(compressed)-4]))
+	for dec.Next() {
+	}
+	if dec.Err() == nil {
+		t.Errorf("Err() of truncated input = nil")
+	}
+	if err := c.NewEncoder(&buf, WithCompression(Compression(9))).Encode(&TestPayload{}); err == nil {
+		t.Errorf("Encode() with unknown compression error = nil")
+	}
+}
@@ -0,0 +1,226 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// DecodeContext decodes an envelope like Decode, but gives up reading r once
+// ctx is done, with an error of kind ErrCanceled wrapping the error of ctx.
+//
+// Reads are checked against ctx before they start. Readers with a
+// SetReadDeadline method, such as net.Conn and os.File, are interrupted while
+// they block, and the deadline of ctx is set as their read deadline. Other
+// readers, such as io.Pipe, are read in a goroutine, which is abandoned once ctx
+// is done: its read returns whenever r does, and what it read is lost, so r
+// cannot be read any further.
+func (c Codec) DecodeContext(ctx context.Context, r any) (Payload, error) {
+	if err := ctx.Err(); err != nil {
+		return Payload{}, newDecodeErr(ErrCanceled, "", err)
+	}
+	cr := &contextReader{ctx: ctx}
+	switch x := r.(type) {
+	case Source:
+		r = contextSource{Source: x, cr: cr}
+	case io.Reader:
+		cr.r = x
+		r = cr
+	}
+	p, err := c.Decode(r)
+	if cr.err != nil {
+		return Payload{}, readErr(err, cr, nil)
+	}
+	return p, err
+}
+
+// DecodeFromContext decodes an envelope like DecodeContext, but reports errors
+// as a Payload holding an ErrorPayload.
+func (c Codec) DecodeFromContext(ctx context.Context, r any) Payload {
+	p, err := c.DecodeContext(ctx, r)
+	if err != nil {
+		return newCodecErr(err, "")
+	}
+	return p
+}
+
+// EncodeToContext writes the envelope of payload like EncodeTo, but gives up
+// writing to w once ctx is done, with an error matching both ErrCanceled and the
+// error of ctx. Writers with a SetWriteDeadline method are interrupted like
+// readers are by DecodeContext.
+func (c Codec) EncodeToContext(ctx context.Context, w any, payload Data) error {
+	if err := ctx.Err(); err != nil {
+		return canceledErr(err)
+	}
+	if x, ok := w.(io.Writer); ok {
+		w = &contextWriter{w: x, ctx: ctx}
+	}
+	err := c.EncodeTo(w, payload)
+	if isContextErr(err) {
+		return canceledErr(err)
+	}
+	return err
+}
+
+// DecodeContext reads the next envelope from the stream like Decode, giving up
+// once ctx is done like Codec.DecodeContext. ctx only applies to this call, so
+// its deadline is a deadline for a single envelope.
+//
+// If ctx is done before the call, the error is returned without affecting the
+// stream. Otherwise the envelope has been read partially and the stream cannot
+// be read any further.
+func (d *Decoder) DecodeContext(ctx context.Context) (Payload, error) {
+	if d.err == nil {
+		if err := ctx.Err(); err != nil {
+			return Payload{}, &DecodeError{Kind: ErrCanceled, Offset: d.inputOffset(), Err: err}
+		}
+	}
+	d.cr.ctx = ctx
+	defer func() { d.cr.ctx = nil }()
+	return d.Decode()
+}
+
+func canceledErr(err error) error {
+	return fmt.Errorf("%w: %w", ErrCanceled, err)
+}
+
+// contextSource reads the opened Source through cr.
+type contextSource struct {
+	Source
+	cr *contextReader
+}
+
+func (s contextSource) Open() (io.ReadCloser, error) {
+	rc, err := s.Source.Open()
+	if err != nil {
+		return nil, err
+	}
+	s.cr.r = rc
+	return struct {
+		io.Reader
+		io.Closer
+	}{s.cr, rc}, nil
+}
+
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// contextReader reads from r until ctx is done. Without ctx it just reads from
+// r. err is the error of ctx that stopped reading.
+type contextReader struct {
+	r   io.Reader
+	ctx context.Context
+	err error
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if r.ctx == nil {
+		return r.r.Read(p)
+	}
+	var set func(time.Time) error
+	if d, ok := r.r.(readDeadliner); ok {
+		set = d.SetReadDeadline
+	}
+	n, err := guard(r.ctx, set, func() (int, error) { return r.r.Read(p) }, func() (int, error) {
+		return readDetached(r.ctx, r.r, p)
+	})
+	if isContextErr(err) {
+		r.err = err
+	}
+	return n, err
+}
+
+// contextWriter writes to w until ctx is done.
+type contextWriter struct {
+	w   io.Writer
+	ctx context.Context
+}
+
+func (w *contextWriter) Write(p []byte) (int, error) {
+	var set func(time.Time) error
+	if d, ok := w.w.(writeDeadliner); ok {
+		set = d.SetWriteDeadline
+	}
+	write := func() (int, error) { return w.w.Write(p) }
+	return guard(w.ctx, set, write, write)
+}
+
+// aLongTimeAgo is a deadline in the past, which interrupts blocked I/O.
+var aLongTimeAgo = time.Unix(1, 0)
+
+// guard runs the read or write op unless ctx is done. If set is not nil, it
+// sets the deadline of op, which is moved to the past to interrupt op once ctx
+// is done. Otherwise it runs fallback instead, which does without deadlines.
+// Errors of op caused by ctx are replaced by the error of ctx.
+func guard(ctx context.Context, set func(time.Time) error, op, fallback func() (int, error)) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if ctx.Done() == nil {
+		return op()
+	}
+	if set == nil {
+		return fallback()
+	}
+
+	deadline, _ := ctx.Deadline()
+	if err := set(deadline); err != nil {
+		// Deadlines are not supported after all, e.g. by pipes.
+		return fallback()
+	}
+	done := make(chan struct{})
+	exited := make(chan struct{})
+	go func() {
+		defer close(exited)
+		select {
+		case <-ctx.Done():
+			_ = set(aLongTimeAgo)
+		case <-done:
+		}
+	}()
+	n, err := op()
+	close(done)
+	<-exited
+	_ = set(time.Time{})
+
+	if err != nil {
+		if cerr := ctx.Err(); cerr != nil {
+			return n, cerr
+		}
+		// The deadline may pass just before ctx notices.
+		if errors.Is(err, os.ErrDeadlineExceeded) && !deadline.IsZero() && !time.Now().Before(deadline) {
+			return n, context.DeadlineExceeded
+		}
+	}
+	return n, err
+}
+
+// readDetached reads from r into p in a goroutine, returning the error of ctx
+// once it is done without waiting for the read, the data of which is lost.
+func readDetached(ctx context.Context, r io.Reader, p []byte) (int, error) {
+	type result struct {
+		n   int
+		err error
+	}
+	// The abandoned read must not write to p.
+	buf := make([]byte, len(p))
+	done := make(chan result, 1)
+	go func() {
+		n, err := r.Read(buf)
+		done <- result{n, err}
+	}()
+	select {
+	case res := <-done:
+		return copy(p, buf[:res.n]), res.err
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	}
+}
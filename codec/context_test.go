@@ -0,0 +1,144 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCodec_DecodeContext(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	c := NewCodec(reg)
+	const env = `{"T":"__codec.Test","Data":{"Data":"test"}}`
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := c.DecodeContext(canceled, env); !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("DecodeContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	p, err := c.DecodeContext(context.Background(), strings.NewReader(env))
+	if err != nil || p.D.(*TestPayload).Data != "test" {
+		t.Errorf("DecodeContext() = %v, %v", p, err)
+	}
+
+	// The writing end sends half an envelope and then stalls.
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() { _, _ = client.Write([]byte(env[:10])) }()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.DecodeContext(ctx, server)
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DecodeContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Pipes have no read deadlines.
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go func() { _, _ = pw.Write([]byte(env[:10])) }()
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = c.DecodeContext(ctx, pr)
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DecodeContext(io.Pipe) error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if p := c.DecodeFromContext(canceled, env); !errors.Is(p.D.(error), context.Canceled) {
+		t.Errorf("DecodeFromContext() = %v, want %v", p.D, context.Canceled)
+	}
+}
+
+func TestCodec_EncodeToContext(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	// Nobody reads from the pipe.
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	err := Codec{}.EncodeToContext(ctx, client, &TestPayload{Data: "test"})
+	if !errors.Is(err, ErrCanceled) || !errors.Is(err, context.Canceled) {
+		t.Errorf("EncodeToContext() error = %v, want %v", err, context.Canceled)
+	}
+
+	go func() { _, _ = io.Copy(io.Discard, server) }()
+	if err := (Codec{}).EncodeToContext(context.Background(), client, &TestPayload{Data: "test"}); err != nil {
+		t.Errorf("EncodeToContext() error = %v", err)
+	}
+}
+
+func TestDecoder_DecodeContext(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	const env = `{"T":"__codec.Test","Data":{"Data":"test"}}` + "\n"
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	go func() { _, _ = client.Write([]byte(env + env[:10])) }()
+	dec := NewCodec(reg).NewDecoder(server)
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := dec.DecodeContext(canceled)
+	if !errors.Is(err, ErrCanceled) {
+		t.Fatalf("DecodeContext() error = %v, want %v", err, ErrCanceled)
+	}
+	// The stream is left as it was.
+	if _, err := dec.DecodeContext(context.Background()); err != nil {
+		t.Fatalf("DecodeContext() error = %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = dec.DecodeContext(ctx)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Kind != ErrCanceled || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("DecodeContext() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if _, err := dec.Decode(); !errors.Is(err, ErrCanceled) || dec.Err() == nil {
+		t.Errorf("Decode() error = %v, want %v", err, ErrCanceled)
+	}
+}
+
+func TestMux_ServeCanceled(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	m := NewMux(NewCodec(nil), WithErrorHandler(func(ctx context.Context, err *MessageError) {
+		t.Errorf("reported %v", err)
+	}))
+	if err := m.Serve(ctx, server); err != context.Canceled {
+		t.Errorf("Serve() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMux_ServePipe(t *testing.T) {
+	pr, pw := io.Pipe()
+	defer pw.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- NewMux(NewCodec(nil)).Serve(ctx, pr) }()
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Errorf("Serve() error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Serve() still blocked on io.Pipe")
+	}
+}
@@ -0,0 +1,298 @@
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	stdjson "encoding/json"
+	"fmt"
+	"io"
+
+	"x/encoding"
+	"x/json"
+)
+
+// Decoder reads successive envelopes, such as newline-delimited JSON, from a
+// single io.Reader.
+type Decoder struct {
+	c Codec
+	// dec reads JSON envelopes, br binary ones.
+	dec json.Decoder
+	br  *countingReader
+	// cr interrupts reads for DecodeContext, lr limits the size of envelopes.
+	cr *contextReader
+	lr *limitReader
+	// compression of the input, unless it is detected.
+	compression Compression
+	detect      bool
+	framing     Framing
+	raw         json.Raw
+	body        bytes.Buffer
+	p           Payload
+	offset      int64
+	err         error
+}
+
+// NewDecoder returns a Decoder reading envelopes from r. The Decoder keeps its
+// own read buffer, so r should not be read from elsewhere while it is in use.
+//
+// Compressed input is decompressed, see WithDecompression, and the offsets of
+// envelopes are offsets in the decompressed stream. Envelopes are expected to be
+// NDJSON or otherwise separated by whitespace, see WithInputFraming.
+func (c Codec) NewDecoder(r io.Reader, opts ...DecoderOption) *Decoder {
+	d := &Decoder{c: c, cr: &contextReader{r: r}, detect: true}
+	for _, opt := range opts {
+		opt(d)
+	}
+	r = d.cr
+	if d.detect || d.compression != NoCompression {
+		r = &decompressReader{r: r, c: d.compression, detect: d.detect, binary: c.wire().Layout == Binary}
+	}
+	if d.lr = c.newLimitReader(r); d.lr != nil {
+		r = d.lr
+	}
+	if c.wire().Layout == Binary {
+		d.br = &countingReader{r: bufio.NewReader(r)}
+	} else {
+		d.dec = d.newFramingDecoder(r)
+	}
+	return d
+}
+
+// WithInputFraming makes the Decoder read envelopes separated by f, like an
+// Encoder writes them with WithFraming. It doesn't apply to the Binary layout
+// and non-JSON drivers either.
+func WithInputFraming(f Framing) DecoderOption {
+	return func(d *Decoder) {
+		d.framing = f
+	}
+}
+
+// newFramingDecoder returns the Decoder of the JSON envelopes of r.
+func (d *Decoder) newFramingDecoder(r io.Reader) json.Decoder {
+	switch d.framing {
+	case NDJSON:
+		return encoding.NewDecoder(d.c.dataDriver(), r)
+	case LengthPrefixed:
+		return &lengthDecoder{d: d.c.dataDriver(), r: bufio.NewReader(r)}
+	case Array:
+		return &arrayDecoder{d: d.c.dataDriver(), dec: stdjson.NewDecoder(r)}
+	}
+	return &arrayDecoder{err: fmt.Errorf("unknown framing %d", d.framing)}
+}
+
+// Decode reads the next envelope from the stream. At the end of the stream it
+// returns io.EOF.
+//
+// Envelopes that are well-formed but cannot be decoded, e.g. of an unknown
+// type, don't stop the stream, and the next call to Decode continues after
+// them. Otherwise the error is returned by all further calls. Errors are of type
+// *DecodeError, with the Offset of the envelope in the stream.
+func (d *Decoder) Decode() (Payload, error) {
+	op, err := d.next()
+	if err != nil {
+		return Payload{}, err
+	}
+	p, err := d.c.payload(op)
+	if err != nil {
+		return p, decodeErrAt(err, d.offset)
+	}
+	return p, nil
+}
+
+// next reads the next envelope from the stream, see Decode.
+func (d *Decoder) next() (op envelope, err error) {
+	if d.err != nil {
+		return op, d.err
+	}
+	if d.lr != nil {
+		d.lr.reset(d.inputOffset())
+	}
+	if d.br != nil {
+		d.offset = d.br.n
+		d.body.Reset()
+		h, rerr := readBinary(d.br, &d.body)
+		if rerr != nil {
+			return op, d.fail(rerr, d.offset)
+		}
+		op, err = d.c.binaryEnvelope(h, d.body.Bytes())
+	} else {
+		d.raw = d.raw[:0]
+		if rerr := d.dec.Decode(&d.raw); rerr != nil {
+			return op, d.fail(rerr, d.dec.InputOffset())
+		}
+		d.offset = d.dec.InputOffset() - int64(len(d.raw))
+		op, err = d.c.parseEnvelope(d.raw)
+	}
+	if err == nil {
+		err = d.c.check(op)
+	}
+	if err != nil {
+		return op, decodeErrAt(err, d.offset)
+	}
+	return op, nil
+}
+
+// fail stops the Decoder after the stream could not be read at offset.
+func (d *Decoder) fail(err error, offset int64) error {
+	if err != io.EOF || d.cr.err != nil {
+		de := readErr(err, d.cr, d.lr)
+		de.Offset = offset
+		err = de
+	}
+	d.err = err
+	return err
+}
+
+// Next reads the next envelope from the stream, see Decode. It returns false
+// when the stream is exhausted or cannot be read any further, see Err.
+//
+// For envelopes that cannot be decoded Payload holds an ErrorPayload, just like
+// for Codec.DecodeFrom.
+func (d *Decoder) Next() bool {
+	p, err := d.Decode()
+	switch {
+	case err == nil:
+		d.p = p
+	case err == d.err:
+		d.p = Payload{}
+		return false
+	default:
+		d.p = newCodecErr(err, "")
+	}
+	return true
+}
+
+// Payload returns the envelope read by the last call to Next.
+func (d *Decoder) Payload() Payload {
+	return d.p
+}
+
+// Offset returns the byte offset in the stream at which the envelope read by
+// the last call to Next starts.
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
+
+// inputOffset returns the offset of the end of the last envelope read.
+func (d *Decoder) inputOffset() int64 {
+	if d.br != nil {
+		return d.br.n
+	}
+	return d.dec.InputOffset()
+}
+
+// Err returns the error that stopped Next, or nil if the stream ended cleanly.
+func (d *Decoder) Err() error {
+	if d.err == io.EOF {
+		return nil
+	}
+	return d.err
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+func (r *countingReader) ReadByte() (byte, error) {
+	b, err := r.r.ReadByte()
+	if err == nil {
+		r.n++
+	}
+	return b, err
+}
+
+// lengthDecoder reads values framed by LengthPrefixed and decodes them with d.
+type lengthDecoder struct {
+	d   json.Driver
+	r   *bufio.Reader
+	buf bytes.Buffer
+	off int64
+}
+
+func (dec *lengthDecoder) Decode(v interface{}) error {
+	var n [4]byte
+	if _, err := io.ReadFull(dec.r, n[:]); err != nil {
+		return err
+	}
+	size := int64(binary.BigEndian.Uint32(n[:]))
+	// The length is untrusted, grow the buffer as data arrives.
+	dec.buf.Reset()
+	if m, err := dec.buf.ReadFrom(io.LimitReader(dec.r, size)); err != nil {
+		return err
+	} else if m < size {
+		return io.ErrUnexpectedEOF
+	}
+	dec.off += int64(len(n)) + size
+	return dec.d.Unmarshal(dec.buf.Bytes(), v)
+}
+
+func (dec *lengthDecoder) More() bool {
+	_, err := dec.r.Peek(1)
+	return err == nil
+}
+
+func (dec *lengthDecoder) InputOffset() int64 {
+	return dec.off
+}
+
+// arrayDecoder reads the elements of a JSON array, as framed by Array, and
+// decodes them with d. Once the array is read, or err is set, it fails with err.
+type arrayDecoder struct {
+	d       json.Driver
+	dec     *stdjson.Decoder
+	raw     stdjson.RawMessage
+	started bool
+	err     error
+}
+
+func (dec *arrayDecoder) Decode(v interface{}) error {
+	if dec.err != nil {
+		return dec.err
+	}
+	if !dec.started {
+		tok, err := dec.dec.Token()
+		if err != nil {
+			// Input without an array holds no envelopes.
+			return err
+		}
+		if tok != stdjson.Delim('[') {
+			return fmt.Errorf("expected an array of envelopes, found %v", tok)
+		}
+		dec.started = true
+	}
+	if !dec.dec.More() {
+		if _, err := dec.dec.Token(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		dec.err = io.EOF
+		return dec.err
+	}
+	dec.raw = dec.raw[:0]
+	if err := dec.dec.Decode(&dec.raw); err != nil {
+		return err
+	}
+	return dec.d.Unmarshal(dec.raw, v)
+}
+
+func (dec *arrayDecoder) More() bool {
+	return dec.err == nil && dec.dec.More()
+}
+
+func (dec *arrayDecoder) InputOffset() int64 {
+	if dec.dec == nil {
+		return 0
+	}
+	return dec.dec.InputOffset()
+}
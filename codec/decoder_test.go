@@ -0,0 +1,189 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDecoder_Next(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantData    []Data
+		wantOffsets []int64
+		wantErr     bool
+	}{
+		{
+			name: "Stream",
+			input: "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"a\"}}\n" +
+				"{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"b\"}}\n",
+			wantData:    []Data{&TestPayload{Data: "a"}, &TestPayload{Data: "b"}},
+			wantOffsets: []int64{0, 41},
+		},
+		{
+			name:        "StreamWhitespace",
+			input:       "  \n{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"a\"}}  ",
+			wantData:    []Data{&TestPayload{Data: "a"}},
+			wantOffsets: []int64{3},
+		},
+		{
+			name: "StreamUndefined",
+			input: "{\"T\":\"__codec.TestUndefined\",\"Data\":{}}\n" +
+				"{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"b\"}}\n",
+			wantData:    []Data{&ErrorPayload{}, &TestPayload{Data: "b"}},
+			wantOffsets: []int64{0, 40},
+		},
+		{
+			name: "StreamBroken",
+			input: "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"a\"}}\n" +
+				"{\"T\":\"__codec.Test\",",
+			wantData:    []Data{&TestPayload{Data: "a"}},
+			wantOffsets: []int64{0},
+			wantErr:     true,
+		},
+		{
+			name: "StreamEmpty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) })).NewDecoder(strings.NewReader(tt.input))
+			var (
+				gotData    []Data
+				gotOffsets []int64
+			)
+			for d.Next() {
+				gotData = append(gotData, d.Payload().D)
+				gotOffsets = append(gotOffsets, d.Offset())
+			}
+			if (d.Err() != nil) != tt.wantErr {
+				t.Fatalf("Err() error = %v, wantErr %v", d.Err(), tt.wantErr)
+			}
+			if len(gotData) != len(tt.wantData) {
+				t.Fatalf("Next() read %d envelopes, want %d", len(gotData), len(tt.wantData))
+			}
+			for i := range gotData {
+				if _, ok := tt.wantData[i].(*ErrorPayload); ok {
+					if _, ok := gotData[i].(*ErrorPayload); !ok {
+						t.Errorf("Payload() = %T, want %T", gotData[i], tt.wantData[i])
+					}
+					continue
+				}
+				if !reflect.DeepEqual(gotData[i], tt.wantData[i]) {
+					t.Errorf("Payload() = %v, want %v", gotData[i], tt.wantData[i])
+				}
+			}
+			if !reflect.DeepEqual(gotOffsets, tt.wantOffsets) {
+				t.Errorf("Offset() = %v, want %v", gotOffsets, tt.wantOffsets)
+			}
+		})
+	}
+}
+
+func TestDecoder_Decode(t *testing.T) {
+	input := "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"a\"}}\n" +
+		"{\"T\":\"__codec.TestUndefined\",\"Data\":{}}\n" +
+		"{\"T\":\"__codec.Test\",\"Data\":{\"Data\":1}}\n" +
+		"{\"T\":\"__codec.Test\","
+	tests := []struct {
+		wantErr    error
+		wantOffset int64
+	}{
+		{wantErr: nil, wantOffset: 0},
+		{wantErr: ErrUnknownType, wantOffset: 41},
+		{wantErr: ErrBodyDecode, wantOffset: 81},
+		{wantErr: ErrMalformedEnvelope},
+		{wantErr: ErrMalformedEnvelope},
+	}
+	d := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) })).NewDecoder(strings.NewReader(input))
+	for i, tt := range tests {
+		_, err := d.Decode()
+		if !errors.Is(err, tt.wantErr) {
+			t.Fatalf("Decode() #%d error = %v, wantErr %v", i, err, tt.wantErr)
+		}
+		var de *DecodeError
+		if errors.As(err, &de) && tt.wantOffset != 0 && de.Offset != tt.wantOffset {
+			t.Errorf("Decode() #%d error offset = %d, want %d", i, de.Offset, tt.wantOffset)
+		}
+	}
+
+	d = NewCodec(NewUnmarshal()).NewDecoder(strings.NewReader(""))
+	if _, err := d.Decode(); err != io.EOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func Test_decodeErrAt(t *testing.T) {
+	for _, err := range []error{
+		newDecodeErr(ErrUnknownType, "__codec.Test", nil),
+		errors.New("driver error"),
+	} {
+		de := decodeErrAt(err, 42)
+		if de.Offset != 42 {
+			t.Errorf("decodeErrAt(%v).Offset = %d, want 42", err, de.Offset)
+		}
+	}
+	if de := decodeErrAt(errors.New("driver error"), 0); !errors.Is(de, ErrMalformedEnvelope) {
+		t.Errorf("decodeErrAt() = %v, want %v", de, ErrMalformedEnvelope)
+	}
+}
+
+func TestDecoder_Framing(t *testing.T) {
+	c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }))
+	for _, f := range []Framing{NDJSON, LengthPrefixed, Array} {
+		w := &bytes.Buffer{}
+		e := c.NewEncoder(w, WithFraming(f))
+		for _, s := range []string{"a", "b", "c"} {
+			if err := e.Encode(&TestPayload{Data: s}); err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+		}
+		if err := e.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+		stream := w.Bytes()
+
+		d := c.NewDecoder(bytes.NewReader(stream), WithInputFraming(f))
+		var got string
+		for d.Next() {
+			got += d.Payload().D.(*TestPayload).Data
+			if !bytes.HasPrefix(stream[d.Offset():], []byte(`{"T":`)) {
+				t.Errorf("framing %d: Offset() = %d, not at an envelope", f, d.Offset())
+			}
+		}
+		if d.Err() != nil || got != "abc" {
+			t.Errorf("framing %d: Decoder read %q, %v, want %q", f, got, d.Err(), "abc")
+		}
+
+		// The envelopes are cut short.
+		d = c.NewDecoder(bytes.NewReader(stream[:len(stream)-2]), WithInputFraming(f))
+		for d.Next() {
+		}
+		if d.Err() == nil {
+			t.Errorf("framing %d: Err() of a truncated stream = nil", f)
+		}
+
+		out := &bytes.Buffer{}
+		if err := TranscodeFrom(out, c.NewDecoder(bytes.NewReader(stream), WithInputFraming(f)), c); err != nil {
+			t.Fatalf("TranscodeFrom() error = %v", err)
+		}
+		if n := strings.Count(out.String(), "\n"); n != 3 {
+			t.Errorf("framing %d: TranscodeFrom() = %q", f, out)
+		}
+	}
+
+	for _, input := range []string{"", "[]", " [ ] "} {
+		d := c.NewDecoder(strings.NewReader(input), WithInputFraming(Array))
+		if d.Next() || d.Err() != nil {
+			t.Errorf("Next() of %q = %v, Err() = %v", input, d.Payload(), d.Err())
+		}
+	}
+	d := c.NewDecoder(strings.NewReader(`{"T":"__codec.Test"}`), WithInputFraming(Array))
+	if d.Next() || !errors.Is(d.Err(), ErrMalformedEnvelope) {
+		t.Errorf("Err() of an object = %v, want %v", d.Err(), ErrMalformedEnvelope)
+	}
+}
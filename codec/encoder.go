@@ -0,0 +1,194 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"x/buffers"
+)
+
+// Framing selects how an Encoder separates envelopes in its output, and how a
+// Decoder expects them to be separated, see WithInputFraming. It doesn't apply
+// to the Binary layout and non-JSON drivers, whose envelopes are
+// self-delimiting.
+type Framing uint8
+
+const (
+	// NDJSON writes every envelope on its own line.
+	NDJSON Framing = iota
+	// LengthPrefixed writes every envelope after its length, as a 4-byte
+	// big-endian unsigned integer.
+	LengthPrefixed
+	// Array writes all envelopes as elements of a single JSON array, which is
+	// terminated by Close.
+	Array
+)
+
+var ErrClosed = errors.New("encoder is closed")
+
+type EncoderOption func(*Encoder)
+
+// WithFraming sets the framing of the envelopes, NDJSON by default.
+func WithFraming(f Framing) EncoderOption {
+	return func(e *Encoder) {
+		e.framing = f
+	}
+}
+
+// WithBuffer makes the Encoder collect its output in a pooled buffer, which is
+// written out once it grows past size bytes or on Flush and Close.
+func WithBuffer(size int) EncoderOption {
+	return func(e *Encoder) {
+		e.size = size
+	}
+}
+
+// Encoder writes a stream of envelopes to a single io.Writer.
+type Encoder struct {
+	c           Codec
+	w           io.Writer
+	framing     Framing
+	size        int
+	compression Compression
+	buf         *bytes.Buffer
+	z           *compressor
+	n           int
+	closed      bool
+}
+
+// NewEncoder returns an Encoder writing envelopes to w.
+func (c Codec) NewEncoder(w io.Writer, opts ...EncoderOption) *Encoder {
+	e := &Encoder{c: c, w: w}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.size > 0 {
+		e.buf = buffers.GetInstance().GetBuffer()
+	}
+	return e
+}
+
+// Encode writes payload as the next envelope of the stream.
+func (e *Encoder) Encode(payload Data) error {
+	return e.encode(newEnvelope(payload))
+}
+
+func (e *Encoder) encode(op envelope) error {
+	if e.closed {
+		return ErrClosed
+	}
+	buf := e.buf
+	if buf == nil {
+		buf = buffers.GetInstance().GetBuffer()
+		defer buffers.GetInstance().PutBuffer(buf)
+	}
+	n := buf.Len()
+	switch {
+	case !e.c.textual():
+		if err := e.c.writeEnvelope(buf, op); err != nil {
+			return err
+		}
+	case e.framing == NDJSON:
+		if err := e.c.writeEnvelope(buf, op); err != nil {
+			return err
+		}
+		buf.WriteByte('\n')
+	case e.framing == LengthPrefixed:
+		buf.Write([]byte{0, 0, 0, 0})
+		if err := e.c.writeEnvelope(buf, op); err != nil {
+			buf.Truncate(n)
+			return err
+		}
+		size := buf.Len() - n - 4
+		if uint64(size) > math.MaxUint32 {
+			buf.Truncate(n)
+			return fmt.Errorf("envelope of %d bytes is too large to be length prefixed", size)
+		}
+		binary.BigEndian.PutUint32(buf.Bytes()[n:], uint32(size))
+	case e.framing == Array:
+		if e.n == 0 {
+			buf.WriteByte('[')
+		} else {
+			buf.WriteByte(',')
+		}
+		if err := e.c.writeEnvelope(buf, op); err != nil {
+			buf.Truncate(n)
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown framing %d", e.framing)
+	}
+	e.n++
+
+	if e.buf == nil || e.buf.Len() >= e.size {
+		return e.flush(buf)
+	}
+	return nil
+}
+
+// Flush writes any buffered output to the underlying io.Writer.
+func (e *Encoder) Flush() error {
+	if e.closed {
+		return ErrClosed
+	}
+	if e.buf == nil {
+		return nil
+	}
+	return e.flush(e.buf)
+}
+
+func (e *Encoder) flush(buf *bytes.Buffer) error {
+	if buf.Len() == 0 {
+		return nil
+	}
+	if e.compression != NoCompression {
+		if err := e.compress(); err != nil {
+			return err
+		}
+		return e.z.flush(buf)
+	}
+	_, err := buf.WriteTo(e.w)
+	return err
+}
+
+// compress sets up the compressor, once it is needed.
+func (e *Encoder) compress() (err error) {
+	if e.z == nil {
+		e.z, err = newCompressor(e.compression, e.w)
+	}
+	return err
+}
+
+// Close terminates the framing and the compression, flushes any buffered output
+// and releases the buffers. It does not close the underlying io.Writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return ErrClosed
+	}
+	e.closed = true
+
+	buf := e.buf
+	if buf == nil {
+		buf = buffers.GetInstance().GetBuffer()
+	}
+	defer buffers.GetInstance().PutBuffer(buf)
+	e.buf = nil
+
+	if e.framing == Array && e.c.textual() {
+		if e.n == 0 {
+			buf.WriteByte('[')
+		}
+		buf.WriteByte(']')
+	}
+	if e.compression != NoCompression {
+		if err := e.compress(); err != nil {
+			return err
+		}
+		return e.z.close(buf)
+	}
+	return e.flush(buf)
+}
@@ -0,0 +1,112 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestEncoder_Encode(t *testing.T) {
+	const envelope = "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"
+	tests := []struct {
+		name string
+		opts []EncoderOption
+		n    int
+		want string
+	}{
+		{
+			name: "NDJSON",
+			n:    2,
+			want: envelope + "\n" + envelope + "\n",
+		},
+		{
+			name: "LengthPrefixed",
+			opts: []EncoderOption{WithFraming(LengthPrefixed)},
+			n:    2,
+			want: "\x00\x00\x00\x2b" + envelope + "\x00\x00\x00\x2b" + envelope,
+		},
+		{
+			name: "Array",
+			opts: []EncoderOption{WithFraming(Array)},
+			n:    2,
+			want: "[" + envelope + "," + envelope + "]",
+		},
+		{
+			name: "ArrayEmpty",
+			opts: []EncoderOption{WithFraming(Array)},
+			want: "[]",
+		},
+		{
+			name: "Buffered",
+			opts: []EncoderOption{WithFraming(Array), WithBuffer(1 << 10)},
+			n:    2,
+			want: "[" + envelope + "," + envelope + "]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &bytes.Buffer{}
+			e := Codec{}.NewEncoder(w, tt.opts...)
+			for i := 0; i < tt.n; i++ {
+				if err := e.Encode(&TestPayload{Data: "test"}); err != nil {
+					t.Fatalf("Encode() error = %v", err)
+				}
+			}
+			if err := e.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+			if got := w.String(); got != tt.want {
+				t.Errorf("Encode() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncoder_Flush(t *testing.T) {
+	w := &bytes.Buffer{}
+	e := Codec{}.NewEncoder(w, WithBuffer(1<<10))
+	if err := e.Encode(&TestPayload{Data: "test"}); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if w.Len() != 0 {
+		t.Errorf("Encode() wrote %d bytes before Flush", w.Len())
+	}
+	if err := e.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if w.Len() == 0 {
+		t.Errorf("Flush() wrote nothing")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := e.Encode(&TestPayload{Data: "test"}); !errors.Is(err, ErrClosed) {
+		t.Errorf("Encode() error = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestEncoder_RoundTrip(t *testing.T) {
+	w := &bytes.Buffer{}
+	c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }))
+	e := c.NewEncoder(w)
+	for _, s := range []string{"a", "b", "c"} {
+		if err := e.Encode(&TestPayload{Data: s}); err != nil {
+			t.Fatalf("Encode() error = %v", err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	d := c.NewDecoder(w)
+	var got string
+	for d.Next() {
+		got += d.Payload().D.(*TestPayload).Data
+	}
+	if d.Err() != nil {
+		t.Fatalf("Err() error = %v", d.Err())
+	}
+	if got != "abc" {
+		t.Errorf("Decoder read %q, want %q", got, "abc")
+	}
+}
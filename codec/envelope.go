@@ -0,0 +1,217 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"x/buffers"
+	"x/encoding"
+	"x/json"
+)
+
+// envelope is the wire form of a Payload. Encoding, the data is taken from D if
+// set and from Data otherwise. Decoding, Data holds the data still encoded.
+type envelope struct {
+	T CType
+	// V is the version of the data, 0 if not set.
+	V    int
+	Data json.Raw
+	D    Data
+	// schema is the Schema the envelope was read with, and driver the driver
+	// Data is encoded with, nil if it wasn't read. If schema has the Inline
+	// layout, Data is still the whole envelope.
+	schema Schema
+	driver json.Driver
+	// seal holds the integrity fields read with the envelope.
+	seal seal
+}
+
+func newEnvelope(d Data) envelope {
+	switch x := d.(type) {
+	case *UnknownPayload:
+		return envelope{T: x.T, V: x.V, Data: x.Data, schema: x.schema, driver: x.driver}
+	case *LazyPayload:
+		return envelope{T: x.T, V: x.V, Data: x.data, schema: x.schema, driver: x.driver}
+	}
+	return envelope{T: d.Type(), V: versionOf(d), D: d}
+}
+
+func (op envelope) version() int {
+	if op.V == 0 {
+		return 1
+	}
+	return op.V
+}
+
+// writeData writes the encoded data of op to buf.
+func (op envelope) writeData(d json.Driver, buf *bytes.Buffer) error {
+	if op.D == nil {
+		if op.Data == nil && isJSON(d) {
+			buf.WriteString("null")
+		} else if op.Data == nil {
+			return d.EncodeStream(buf, nil)
+		}
+		buf.Write(op.Data)
+		return nil
+	}
+	if err := d.EncodeStream(buf, op.D); err != nil {
+		return err
+	}
+	// EncodeStream terminates JSON values with a newline.
+	if b := buf.Bytes(); isJSON(d) && len(b) > 0 && b[len(b)-1] == '\n' {
+		buf.Truncate(len(b) - 1)
+	}
+	return nil
+}
+
+// writeEnvelope writes op to buf. On error buf is left as it was.
+func (c Codec) writeEnvelope(buf *bytes.Buffer, op envelope) error {
+	if op.D != nil {
+		if err := c.Unmarshal.validate(op.D); err != nil {
+			return validationErr(op.T, err)
+		}
+	}
+	s := c.wire()
+	alias, renamed := c.aliases[op.T]
+	if op.driver != nil && op.schema.Layout == Inline {
+		// Write the envelope as it was read if nothing changes.
+		if !renamed && s == op.schema && encoding.ContentType(c.dataDriver()) == encoding.ContentType(op.driver) {
+			buf.Write(op.Data)
+			return nil
+		}
+		data, err := op.schema.inlineData(op.driver, op.Data)
+		if err != nil {
+			return err
+		}
+		op.Data, op.schema = data, Schema{}
+	}
+	if op.driver != nil {
+		if from, to := encoding.ContentType(op.driver), encoding.ContentType(c.dataDriver()); from != to {
+			return fmt.Errorf("the data of %s is %s and cannot be written as %s", op.T, from, to)
+		}
+	}
+	if s.Layout == Binary {
+		return c.writeBinary(buf, op)
+	}
+	if renamed {
+		op.T = alias
+	}
+	return s.write(c.dataDriver(), buf, op, c.sealer())
+}
+
+// check checks op, as read, against the limits of c and its integrity fields.
+func (c Codec) check(op envelope) error {
+	if err := c.checkBody(op); err != nil {
+		return err
+	}
+	return c.verify(op)
+}
+
+// inlineData returns the data of the Inline envelope raw written with s and d,
+// without the keys of the envelope.
+func (s Schema) inlineData(d json.Driver, raw []byte) (json.Raw, error) {
+	var m map[string]json.Raw
+	if err := d.Unmarshal(raw, &m); err != nil {
+		return nil, err
+	}
+	delete(m, s.Type)
+	delete(m, s.Version)
+	return d.Marshal(m)
+}
+
+// parseEnvelope reads the envelope raw. Errors are of type *DecodeError.
+func (c Codec) parseEnvelope(raw []byte) (envelope, error) {
+	s := c.wire()
+	if s.Layout == Binary {
+		h, body, err := parseBinary(raw)
+		if err != nil {
+			return envelope{}, newDecodeErr(ErrMalformedEnvelope, "", err)
+		}
+		return c.binaryEnvelope(h, body)
+	}
+	op, err := s.parse(c.dataDriver(), raw, c.strict)
+	if err != nil {
+		return envelope{}, newReadErr(err)
+	}
+	return op, nil
+}
+
+// readEnvelope reads a single envelope from r, using buf to hold it. Errors are
+// of type *DecodeError.
+func (c Codec) readEnvelope(r io.Reader, buf *bytes.Buffer) (envelope, error) {
+	lr := c.newLimitReader(r)
+	if lr != nil {
+		r = lr
+	}
+	s := c.wire()
+	if s.Layout == Binary {
+		br, ok := r.(byteReader)
+		if !ok {
+			br = oneByteReader{Reader: r}
+		}
+		h, err := readBinary(br, buf)
+		if err != nil {
+			return envelope{}, readErr(err, nil, lr)
+		}
+		if c.strict {
+			if _, err := br.ReadByte(); err != io.EOF {
+				return envelope{}, trailingDataErr()
+			}
+		}
+		return c.binaryEnvelope(h, buf.Bytes())
+	}
+
+	// Keep a copy of what is read to get hold of the raw envelope, which the
+	// decoder only consumes as far as it needs to.
+	var m map[string]json.Raw
+	dec := encoding.NewDecoder(c.dataDriver(), io.TeeReader(r, buf))
+	if err := dec.Decode(&m); err != nil {
+		return envelope{}, readErr(err, nil, lr)
+	}
+	raw := buf.Bytes()[:dec.InputOffset()]
+	if isJSON(c.dataDriver()) {
+		raw = bytes.TrimLeft(raw, " \t\r\n")
+	}
+	op, err := s.envelope(c.dataDriver(), m, raw, c.strict)
+	if err != nil {
+		return envelope{}, newDecodeErr(ErrMalformedEnvelope, "", err)
+	}
+	if c.strict {
+		if err := dec.Decode(&json.Raw{}); err != io.EOF {
+			return envelope{}, trailingDataErr()
+		}
+	}
+	return op, nil
+}
+
+func trailingDataErr() *DecodeError {
+	return newDecodeErr(ErrMalformedEnvelope, "", &json.StrictError{Path: "$", Err: json.ErrTrailingData})
+}
+
+func (c Codec) decodeReader(r io.Reader, fn func(envelope) (Payload, error)) (Payload, error) {
+	buf := buffers.GetInstance().GetBuffer()
+	defer buffers.GetInstance().PutBuffer(buf)
+	op, err := c.readEnvelope(r, buf)
+	if err != nil {
+		return Payload{}, err
+	}
+	if err := c.check(op); err != nil {
+		return Payload{}, err
+	}
+	return fn(op)
+}
+
+func (c Codec) decodeEnvelope(raw []byte, fn func(envelope) (Payload, error)) (Payload, error) {
+	if err := c.checkSize(raw); err != nil {
+		return Payload{}, err
+	}
+	op, err := c.parseEnvelope(raw)
+	if err != nil {
+		return Payload{}, err
+	}
+	if err := c.check(op); err != nil {
+		return Payload{}, err
+	}
+	return fn(op)
+}
@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"x/encoding"
+)
+
+// The kinds of DecodeError. Their messages match the ones DecodeFrom has
+// always reported.
+var (
+	ErrMalformedEnvelope error = &kind{msg: "cannot read JSON stream"}
+	ErrUnknownType       error = &kind{msg: "configuration not defined", typed: true}
+	ErrBodyDecode        error = &kind{msg: "cannot read JSON data"}
+	ErrUnsupportedSource error = &kind{msg: "unknown config"}
+	ErrOpenSource        error = &kind{msg: "cannot open source"}
+	ErrMigration         error = &kind{msg: "cannot migrate data", typed: true}
+	ErrValidation        error = &kind{msg: "invalid data", typed: true}
+	// ErrCanceled reports a read or write cut short by its context, the
+	// error of which is wrapped.
+	ErrCanceled error = &kind{msg: "canceled"}
+	// ErrTooLarge and ErrTooDeep report envelopes exceeding the Limits of the
+	// Codec. The errors of drivers they wrap match encoding.ErrTooLarge and
+	// encoding.ErrTooDeep.
+	ErrTooLarge error = &kind{msg: "too large", typed: true}
+	ErrTooDeep  error = &kind{msg: "nested too deeply"}
+	// ErrIntegrity reports an envelope with a digest or signature that does
+	// not match its data, or without a signature when one is required.
+	ErrIntegrity error = &kind{msg: "integrity check failed", typed: true}
+)
+
+// kind is a kind of DecodeError. The messages of typed kinds name the type of
+// the envelope.
+type kind struct {
+	msg   string
+	typed bool
+}
+
+func (k *kind) Error() string {
+	return k.msg
+}
+
+// DecodeError reports an envelope that could not be decoded. It matches its Kind
+// with errors.Is.
+type DecodeError struct {
+	Kind error
+	// Type is the type of the envelope, if it could be read.
+	Type CType
+	// Offset is the byte offset of the envelope in its stream.
+	Offset int64
+	Err    error
+
+	// inErr is set if the message of Err holds the one of Kind.
+	inErr bool
+}
+
+func newDecodeErr(kind error, t CType, err error) *DecodeError {
+	return &DecodeError{Kind: kind, Type: t, Err: err}
+}
+
+// readErr returns the DecodeError of an envelope that could not be read with
+// err through cr and lr, which may be nil. Drivers may not pass on the errors
+// of these readers, so those take precedence over err.
+func readErr(err error, cr *contextReader, lr *limitReader) *DecodeError {
+	switch {
+	case cr != nil && cr.err != nil:
+		return newDecodeErr(ErrCanceled, "", cr.err)
+	case lr != nil && lr.err != nil:
+		return newDecodeErr(ErrTooLarge, "", lr.err)
+	}
+	return newReadErr(err)
+}
+
+// newReadErr returns the DecodeError of an envelope that could not be read.
+func newReadErr(err error) *DecodeError {
+	switch {
+	case isContextErr(err):
+		return newDecodeErr(ErrCanceled, "", err)
+	case errors.Is(err, encoding.ErrTooLarge):
+		// The message of the driver says what is too large.
+		return &DecodeError{Kind: ErrTooLarge, Err: err, inErr: true}
+	case errors.Is(err, encoding.ErrTooDeep):
+		return &DecodeError{Kind: ErrTooDeep, Err: err, inErr: true}
+	}
+	return newDecodeErr(ErrMalformedEnvelope, "", err)
+}
+
+// decodeErrAt returns err as a DecodeError of the envelope at offset. Errors of
+// other types are classified like newReadErr does.
+func decodeErrAt(err error, offset int64) *DecodeError {
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		de = newReadErr(err)
+	}
+	de.Offset = offset
+	return de
+}
+
+func isContextErr(err error) bool {
+	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+func (e *DecodeError) Error() string {
+	if e.inErr {
+		return e.Err.Error()
+	}
+	var b strings.Builder
+	b.WriteString(e.Kind.Error())
+	if k, ok := e.Kind.(*kind); ok && k.typed && e.Type != "" {
+		b.WriteString(" for ")
+		b.WriteString(string(e.Type))
+	}
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	return b.String()
+}
+
+func (e *DecodeError) Is(target error) bool {
+	return target == e.Kind
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
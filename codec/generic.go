@@ -0,0 +1,42 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+)
+
+var ErrTypeMismatch = errors.New("type mismatch")
+
+// DataPtr is satisfied by *T implementing Data.
+type DataPtr[T any] interface {
+	*T
+	Data
+}
+
+// New returns a new *T as Data, it is the Func of T.
+func New[T any, PT DataPtr[T]]() Data {
+	return PT(new(T))
+}
+
+// TypeOf returns the CType of T.
+func TypeOf[T any, PT DataPtr[T]]() CType {
+	return PT(new(T)).Type()
+}
+
+// Register adds T to reg, see Registry.Register.
+func Register[T any, PT DataPtr[T]](reg *Registry) error {
+	return reg.Register(New[T, PT])
+}
+
+// DecodeAs decodes an envelope from r like Codec.Decode, and returns its data if
+// it is a T. Otherwise the error is ErrTypeMismatch.
+func DecodeAs[T any, PT DataPtr[T]](c Codec, r any) (*T, error) {
+	p, err := c.Decode(r)
+	if err != nil {
+		return nil, err
+	}
+	if d, ok := p.D.(PT); ok {
+		return d, nil
+	}
+	return nil, fmt.Errorf("%w: got %s, want %s", ErrTypeMismatch, p.T, TypeOf[T, PT]())
+}
@@ -0,0 +1,69 @@
+package codec
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := Register[TestPayload](reg); !errors.Is(err, ErrDuplicateType) {
+		t.Errorf("Register() error = %v, wantErr %v", err, ErrDuplicateType)
+	}
+	fn := reg.Lookup(TypeOf[TestPayload]())
+	if fn == nil {
+		t.Fatalf("Lookup() = nil")
+	}
+	if got := fn(); !reflect.DeepEqual(got, &TestPayload{}) {
+		t.Errorf("Lookup()() = %v, want %v", got, &TestPayload{})
+	}
+}
+
+func TestDecodeAs(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := Register[TestEmptyPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	c := NewCodec(reg)
+
+	tests := []struct {
+		name    string
+		r       any
+		want    *TestPayload
+		wantErr error
+	}{
+		{
+			name: "DecodeAs",
+			r:    []byte("{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"),
+			want: &TestPayload{Data: "test"},
+		},
+		{
+			name:    "DecodeAsMismatch",
+			r:       []byte("{\"T\":\"__codec.TestEmpty\",\"Data\":{}}"),
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "DecodeAsUndefined",
+			r:       []byte("{\"T\":\"__codec.TestUndefined\",\"Data\":{}}"),
+			wantErr: ErrUnknownType,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeAs[TestPayload](c, tt.r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeAs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DecodeAs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
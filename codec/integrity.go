@@ -0,0 +1,198 @@
+package codec
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+)
+
+// Checksum selects the digest of the data written to envelopes.
+type Checksum uint8
+
+const (
+	NoChecksum Checksum = iota
+	// CRC32 is the IEEE CRC-32 checksum, which detects corruption.
+	CRC32
+	// SHA256 is the SHA-256 hash.
+	SHA256
+)
+
+var checksumNames = [...]string{CRC32: "crc32", SHA256: "sha256"}
+
+func (s Checksum) String() string {
+	if int(s) < len(checksumNames) && checksumNames[s] != "" {
+		return checksumNames[s]
+	}
+	return "checksum(" + strconv.Itoa(int(s)) + ")"
+}
+
+// sum returns the digest of data, nil for unknown checksums.
+func (s Checksum) sum(data []byte) []byte {
+	switch s {
+	case CRC32:
+		return binary.BigEndian.AppendUint32(nil, crc32.ChecksumIEEE(data))
+	case SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+	return nil
+}
+
+// size returns the size of the digest, 0 for unknown checksums.
+func (s Checksum) size() int {
+	switch s {
+	case CRC32:
+		return crc32.Size
+	case SHA256:
+		return sha256.Size
+	}
+	return 0
+}
+
+// KeyFunc returns the key the signature of an envelope was made with, by the
+// key id written along with it. Returning different keys for different ids
+// allows keys to be rotated.
+type KeyFunc func(keyID string) ([]byte, error)
+
+// WithChecksum writes a digest of the data with every envelope. Digests are
+// verified when decoding, whether the option is set or not.
+//
+// Digests and signatures are written under the Digest and Signature keys of the
+// Schema, so they need the Wrapped or the Binary layout.
+func WithChecksum(s Checksum) Option {
+	return func(c *Codec) {
+		c.checksum = s
+	}
+}
+
+// WithSigningKey signs every envelope with an HMAC-SHA256 of its type, version
+// and data, and writes keyID along with it. Envelopes fail to be written if key
+// is empty.
+func WithSigningKey(keyID string, key []byte) Option {
+	return func(c *Codec) {
+		c.signed, c.keyID, c.key = true, keyID, key
+	}
+}
+
+// WithKeys makes the Codec verify the signatures of envelopes with the keys
+// returned by fn, and reject envelopes without a signature. Without it,
+// signatures are not verified.
+func WithKeys(fn KeyFunc) Option {
+	return func(c *Codec) {
+		c.keys = fn
+	}
+}
+
+// seal holds the integrity fields of an envelope.
+type seal struct {
+	sum    Checksum
+	digest []byte
+	keyID  string
+	mac    []byte
+}
+
+// sealer returns the function computing the integrity fields of the envelopes
+// c writes, or nil if there are none.
+func (c Codec) sealer() func(op envelope, data []byte) (seal, error) {
+	if c.checksum == NoChecksum && !c.signed {
+		return nil
+	}
+	return c.seal
+}
+
+func (c Codec) seal(op envelope, data []byte) (s seal, err error) {
+	if c.checksum != NoChecksum {
+		if s.digest = c.checksum.sum(data); s.digest == nil {
+			return s, fmt.Errorf("unknown checksum %d", c.checksum)
+		}
+		s.sum = c.checksum
+	}
+	if c.signed {
+		if len(c.key) == 0 {
+			return s, fmt.Errorf("empty signing key %q", c.keyID)
+		}
+		s.keyID = c.keyID
+		s.mac = signature(c.key, op.T, op.version(), data)
+	}
+	return s, nil
+}
+
+func signature(key []byte, t CType, v int, data []byte) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(t))
+	m.Write([]byte{0})
+	m.Write(strconv.AppendInt(nil, int64(v), 10))
+	m.Write([]byte{0})
+	m.Write(data)
+	return m.Sum(nil)
+}
+
+// verify checks the integrity fields of op. Errors are of type *DecodeError.
+func (c Codec) verify(op envelope) error {
+	s := op.seal
+	if s.sum != NoChecksum && !bytes.Equal(s.sum.sum(op.Data), s.digest) {
+		return newDecodeErr(ErrIntegrity, op.T, fmt.Errorf("%s digest mismatch", s.sum))
+	}
+	if c.keys == nil {
+		return nil
+	}
+	if s.mac == nil {
+		return newDecodeErr(ErrIntegrity, op.T, errors.New("envelope is not signed"))
+	}
+	key, err := c.keys(s.keyID)
+	if err != nil {
+		return newDecodeErr(ErrIntegrity, op.T, fmt.Errorf("key %q: %w", s.keyID, err))
+	}
+	if len(key) == 0 {
+		return newDecodeErr(ErrIntegrity, op.T, fmt.Errorf("key %q is empty", s.keyID))
+	}
+	if !hmac.Equal(signature(key, op.T, op.version(), op.Data), s.mac) {
+		return newDecodeErr(ErrIntegrity, op.T, fmt.Errorf("signature mismatch with key %q", s.keyID))
+	}
+	return nil
+}
+
+// digestString returns the digest of s as written to envelopes, e.g.
+// "crc32:cbf43926".
+func (s seal) digestString() string {
+	return s.sum.String() + ":" + hex.EncodeToString(s.digest)
+}
+
+func parseDigest(v string) (Checksum, []byte, error) {
+	name, digest, _ := strings.Cut(v, ":")
+	for s, n := range checksumNames {
+		if n != "" && n == name {
+			b, err := hex.DecodeString(digest)
+			if err != nil || len(b) != Checksum(s).size() {
+				return NoChecksum, nil, fmt.Errorf("invalid %s digest %q", name, digest)
+			}
+			return Checksum(s), b, nil
+		}
+	}
+	return NoChecksum, nil, fmt.Errorf("unknown checksum %q", name)
+}
+
+// signatureString returns the signature of s as written to envelopes, the key
+// id and the HMAC separated by a colon.
+func (s seal) signatureString() string {
+	return s.keyID + ":" + hex.EncodeToString(s.mac)
+}
+
+func parseSignature(v string) (string, []byte, error) {
+	i := strings.LastIndexByte(v, ':')
+	if i < 0 {
+		return "", nil, fmt.Errorf("invalid signature %q", v)
+	}
+	mac, err := hex.DecodeString(v[i+1:])
+	if err != nil || len(mac) != sha256.Size {
+		return "", nil, fmt.Errorf("invalid signature %q", v)
+	}
+	return v[:i], mac, nil
+}
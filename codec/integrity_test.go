@@ -0,0 +1,128 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"x/encoding/cbor"
+)
+
+func TestCodec_Integrity(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	keys := func(keyID string) ([]byte, error) {
+		switch keyID {
+		case "k1":
+			return []byte("old secret"), nil
+		case "k2":
+			return []byte("new secret"), nil
+		case "empty":
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unknown key")
+	}
+	layouts := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "V1"},
+		{name: "V2", opts: []Option{WithSchema(SchemaV2)}},
+		{name: "Binary", opts: []Option{WithSchema(SchemaBinary)}},
+		{name: "CBOR", opts: []Option{WithDriver(cbor.Driver{})}},
+	}
+	tests := []struct {
+		name    string
+		write   []Option
+		read    []Option
+		tamper  bool
+		wantErr error
+	}{
+		{name: "CRC32", write: []Option{WithChecksum(CRC32)}},
+		{name: "SHA256", write: []Option{WithChecksum(SHA256)}},
+		{name: "CRC32Tampered", write: []Option{WithChecksum(CRC32)}, tamper: true, wantErr: ErrIntegrity},
+		{name: "Signed", write: []Option{WithSigningKey("k1", []byte("old secret"))}, read: []Option{WithKeys(keys)}},
+		{name: "Rotated", write: []Option{WithChecksum(SHA256), WithSigningKey("k2", []byte("new secret"))}, read: []Option{WithKeys(keys)}},
+		{name: "SignedTampered", write: []Option{WithSigningKey("k1", []byte("old secret"))}, read: []Option{WithKeys(keys)}, tamper: true, wantErr: ErrIntegrity},
+		{name: "WrongKey", write: []Option{WithSigningKey("k1", []byte("new secret"))}, read: []Option{WithKeys(keys)}, wantErr: ErrIntegrity},
+		{name: "UnknownKey", write: []Option{WithSigningKey("k3", []byte("old secret"))}, read: []Option{WithKeys(keys)}, wantErr: ErrIntegrity},
+		{name: "EmptyKey", write: []Option{WithSigningKey("empty", []byte("old secret"))}, read: []Option{WithKeys(keys)}, wantErr: ErrIntegrity},
+		{name: "Unsigned", read: []Option{WithKeys(keys)}, wantErr: ErrIntegrity},
+		{name: "SignedNotVerified", write: []Option{WithSigningKey("k1", []byte("old secret"))}, tamper: true},
+	}
+	for _, l := range layouts {
+		for _, tt := range tests {
+			t.Run(l.name+"/"+tt.name, func(t *testing.T) {
+				b, err := NewCodec(reg, append(tt.write, l.opts...)...).Marshal(&TestPayload{Data: "test"})
+				if err != nil {
+					t.Fatalf("Marshal() error = %v", err)
+				}
+				if tt.tamper {
+					b = bytes.Replace(b, []byte("test"), []byte("tesT"), 1)
+				}
+				c := NewCodec(reg, append(tt.read, l.opts...)...)
+				for _, r := range []any{b, bytes.NewReader(b)} {
+					p, err := c.Decode(r)
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("Decode(%T) error = %v, want %v", r, err, tt.wantErr)
+					}
+					if err == nil {
+						if d, ok := p.D.(*TestPayload); !ok || d.Data != "test" && !tt.tamper {
+							t.Errorf("Decode(%T) = %v", r, p.D)
+						}
+					}
+				}
+				_, err = c.NewDecoder(bytes.NewReader(b)).Decode()
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Decoder.Decode() error = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+}
+
+func TestCodec_IntegrityFormat(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	c := NewCodec(reg, WithSchema(SchemaV2), WithChecksum(CRC32), WithSigningKey("k:1", []byte("secret")))
+	b, err := c.Marshal(&TestPayload{Data: "test"})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	const want = `{"type":"__codec.Test","data":{"Data":"test"},"digest":"crc32:`
+	if !strings.HasPrefix(string(b), want) || !strings.Contains(string(b), `"signature":"k:1:`) {
+		t.Errorf("Marshal() = %s", b)
+	}
+	// Key ids may hold colons.
+	if _, err := NewCodec(reg, WithSchema(SchemaV2), WithKeys(func(keyID string) ([]byte, error) {
+		if keyID != "k:1" {
+			return nil, fmt.Errorf("unknown key %q", keyID)
+		}
+		return []byte("secret"), nil
+	})).Decode(b); err != nil {
+		t.Errorf("Decode() error = %v", err)
+	}
+
+	for _, data := range []string{
+		`{"type":"__codec.Test","data":{},"digest":"md5:00"}`,
+		`{"type":"__codec.Test","data":{},"digest":"crc32:zz"}`,
+		`{"type":"__codec.Test","data":{},"signature":"nokey"}`,
+		`{"type":"__codec.Test","data":{},"signature":1}`,
+	} {
+		if _, err := NewCodec(reg, WithSchema(SchemaV2)).Decode(data); !errors.Is(err, ErrMalformedEnvelope) {
+			t.Errorf("Decode(%s) error = %v, want %v", data, err, ErrMalformedEnvelope)
+		}
+	}
+
+	if _, err := NewCodec(reg, WithSchema(SchemaInline), WithChecksum(CRC32)).Marshal(&TestPayload{}); err == nil {
+		t.Errorf("Marshal() with SchemaInline error = nil")
+	}
+	if _, err := NewCodec(reg, WithChecksum(Checksum(9))).Marshal(&TestPayload{}); err == nil {
+		t.Errorf("Marshal() with unknown checksum error = nil")
+	}
+	for _, key := range [][]byte{nil, {}} {
+		if _, err := NewCodec(reg, WithSigningKey("nope", key)).Marshal(&TestPayload{}); err == nil {
+			t.Errorf("Marshal() with signing key %#v error = nil", key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"sync"
+
+	"x/json"
+)
+
+// LazyPayload is an envelope whose data is only decoded on demand, for callers
+// like routers which mostly look at the type. Encoded, it writes its data as it
+// is, so forwarding it doesn't decode it at all, which needs a Codec with a
+// driver of the same format.
+type LazyPayload struct {
+	T CType
+	// V is the version of the data, 0 if the envelope has none.
+	V int
+
+	c    Codec
+	data json.Raw
+	// schema and driver are the Schema and driver the envelope was read with,
+	// the Schema being SchemaV1 for legacy envelopes whatever the Schema of c.
+	schema Schema
+	driver json.Driver
+
+	once sync.Once
+	d    Data
+	err  error
+}
+
+func (p *LazyPayload) Type() CType {
+	return p.T
+}
+
+// Raw returns the encoded data. For Inline envelopes it's the whole envelope.
+func (p *LazyPayload) Raw() json.Raw {
+	return p.data
+}
+
+// Decode decodes the data like Codec.Decode would have, and returns the
+// resulting Data. The data is decoded once, later calls return the same
+// result. Errors are of type *DecodeError.
+func (p *LazyPayload) Decode() (Data, error) {
+	p.once.Do(func() {
+		var payload Payload
+		payload, p.err = p.c.payload(envelope{T: p.T, V: p.V, Data: p.data, schema: p.schema, driver: p.driver})
+		p.d = payload.D
+	})
+	return p.d, p.err
+}
+
+// DecodeLazy reads an envelope from r like Decode, but leaves decoding its data
+// to LazyPayload.Decode. Only errors reading the envelope are returned, which
+// are of type *DecodeError.
+func (c Codec) DecodeLazy(r any) (*LazyPayload, error) {
+	p, err := c.decode(r, c.lazyPayload)
+	if err != nil {
+		return nil, err
+	}
+	return p.D.(*LazyPayload), nil
+}
+
+// DecodeLazy reads the next envelope from the stream like Decode, but leaves
+// decoding its data to LazyPayload.Decode.
+func (d *Decoder) DecodeLazy() (*LazyPayload, error) {
+	op, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	p, _ := d.c.lazyPayload(op)
+	return p.D.(*LazyPayload), nil
+}
+
+func (c Codec) lazyPayload(op envelope) (Payload, error) {
+	// op.Data may be held by a reused buffer.
+	p := &LazyPayload{T: op.T, V: op.V, c: c, schema: op.schema, driver: op.driver}
+	if p.driver == nil {
+		p.driver = c.dataDriver()
+	}
+	if op.Data != nil {
+		p.data = append(json.Raw{}, op.Data...)
+	}
+	return Payload{T: op.T, D: p}, nil
+}
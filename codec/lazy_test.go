@@ -0,0 +1,174 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"x/encoding/cbor"
+)
+
+func TestCodec_DecodeLazy(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatal(err)
+	}
+	c := NewCodec(reg)
+
+	const input = `{"T":"__codec.Test","Data":{"Data": "test"}}`
+	p, err := c.DecodeLazy(input)
+	if err != nil {
+		t.Fatalf("DecodeLazy() error = %v", err)
+	}
+	if p.Type() != "__codec.Test" || p.Raw().String() != `{"Data": "test"}` {
+		t.Errorf("DecodeLazy() = %s %s", p.Type(), p.Raw())
+	}
+	if b, err := c.Marshal(p); err != nil || string(b) != input {
+		t.Errorf("Marshal() = %s, %v, want %s", b, err, input)
+	}
+
+	var wg sync.WaitGroup
+	results := make([]Data, 4)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], _ = p.Decode()
+		}(i)
+	}
+	wg.Wait()
+	d, err := p.Decode()
+	if err != nil || d.(*TestPayload).Data != "test" {
+		t.Fatalf("Decode() = %v, %v", d, err)
+	}
+	for _, r := range results {
+		if r != d {
+			t.Errorf("Decode() = %p, want the cached %p", r, d)
+		}
+	}
+
+	if _, err := c.DecodeLazy(`{"T":`); !errors.Is(err, ErrMalformedEnvelope) {
+		t.Errorf("DecodeLazy() error = %v, wantErr %v", err, ErrMalformedEnvelope)
+	}
+	p, err = c.DecodeLazy(`{"T":"__codec.Other","Data":{}}`)
+	if err != nil {
+		t.Fatalf("DecodeLazy() error = %v", err)
+	}
+	if _, err := p.Decode(); !errors.Is(err, ErrUnknownType) {
+		t.Errorf("Decode() error = %v, wantErr %v", err, ErrUnknownType)
+	}
+}
+
+func TestCodec_DecodeLazy_Inline(t *testing.T) {
+	const input = `{"version":2, "type":"__codec.Other","a":1}`
+	c := NewCodec(NewRegistry(), WithSchema(SchemaInline))
+	p, err := c.DecodeLazy(input)
+	if err != nil {
+		t.Fatalf("DecodeLazy() error = %v", err)
+	}
+	if p.V != 2 || p.Raw().String() != input {
+		t.Errorf("DecodeLazy() = %d %s", p.V, p.Raw())
+	}
+	if b, err := c.Marshal(p); err != nil || string(b) != input {
+		t.Errorf("Marshal() = %s, %v, want %s", b, err, input)
+	}
+	b, err := NewCodec(nil, WithSchema(SchemaV2)).Marshal(p)
+	if want := `{"type":"__codec.Other","version":2,"data":{"a":1}}`; err != nil || string(b) != want {
+		t.Errorf("Marshal() = %s, %v, want %s", b, err, want)
+	}
+}
+
+func TestDecoder_DecodeLazy(t *testing.T) {
+	c := NewCodec(NewRegistry())
+	dec := c.NewDecoder(strings.NewReader(`{"T":"__codec.A","Data":{"a":1}}
+{"T":"__codec.B","Data":{"bb":2}}
+`))
+	var got []*LazyPayload
+	for {
+		p, err := dec.DecodeLazy()
+		if err != nil {
+			if err != io.EOF {
+				t.Fatalf("DecodeLazy() error = %v", err)
+			}
+			break
+		}
+		got = append(got, p)
+	}
+	if len(got) != 2 || got[0].Raw().String() != `{"a":1}` || got[1].Raw().String() != `{"bb":2}` {
+		t.Errorf("DecodeLazy() = %v", got)
+	}
+}
+
+func TestCodec_DecodeLazy_Legacy(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	c := NewCodec(reg, WithSchema(SchemaInline))
+	p, err := c.DecodeLazy(`{"T":"__codec.Test","Data":{"Data":"test"}}`)
+	if err != nil {
+		t.Fatalf("DecodeLazy() error = %v", err)
+	}
+	if d, err := p.Decode(); err != nil || d.(*TestPayload).Data != "test" {
+		t.Errorf("Decode() = %v, %v", d, err)
+	}
+	b, err := c.Marshal(p)
+	if want := `{"type":"__codec.Test","Data":"test"}`; err != nil || string(b) != want {
+		t.Errorf("Marshal() = %s, %v, want %s", b, err, want)
+	}
+
+	// Inlining the data would make its own type key the one of the envelope.
+	p, err = c.DecodeLazy(`{"T":"zz","Data":{"Name":"a","type":"x"}}`)
+	if err != nil {
+		t.Fatalf("DecodeLazy() error = %v", err)
+	}
+	if b, err := c.Marshal(p); err == nil {
+		t.Errorf("Marshal() = %s, want an error", b)
+	}
+	if b, err := NewCodec(reg, WithDriver(cbor.Driver{}), WithSchema(SchemaInline)).Marshal(p); err == nil {
+		t.Errorf("Marshal() = %x, want an error", b)
+	}
+}
+
+func TestCodec_DecodeLazy_Driver(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	for _, s := range []Schema{SchemaV2, SchemaInline, SchemaBinary} {
+		c := NewCodec(reg, WithSchema(s))
+		b, err := c.Marshal(&TestPayload{Data: "test"})
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		p, err := c.DecodeLazy(b)
+		if err != nil {
+			t.Fatalf("DecodeLazy() error = %v", err)
+		}
+		if b, err := NewCodec(reg, WithDriver(cbor.Driver{}), WithSchema(s)).Marshal(p); err == nil {
+			t.Errorf("Marshal() of JSON data as CBOR = %x, want an error", b)
+		}
+		if _, err := NewCodec(reg, WithSchema(SchemaV1)).Marshal(p); err != nil {
+			t.Errorf("Marshal() error = %v", err)
+		}
+	}
+}
+
+func TestCodec_DecodeLazy_Unknown(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	b, err := NewCodec(reg, WithDriver(cbor.Driver{})).Marshal(&TestPayload{Data: "x"})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	p, err := NewCodec(NewRegistry(), WithDriver(cbor.Driver{}), WithUnknown(KeepUnknown)).DecodeLazy(b)
+	if err != nil {
+		t.Fatalf("DecodeLazy() error = %v", err)
+	}
+	d, err := p.Decode()
+	if _, ok := d.(*UnknownPayload); err != nil || !ok {
+		t.Fatalf("Decode() = %T, %v, want *UnknownPayload", d, err)
+	}
+	if got, err := NewCodec(reg).Marshal(d); err == nil {
+		t.Errorf("Marshal() of CBOR data as JSON = %q, want an error", got)
+	}
+	if got, err := NewCodec(reg, WithDriver(cbor.Driver{})).Marshal(d); err != nil || !bytes.Equal(got, b) {
+		t.Errorf("Marshal() = %x, %v, want %x", got, err, b)
+	}
+}
@@ -0,0 +1,137 @@
+package codec
+
+import (
+	"fmt"
+	"io"
+
+	"x/encoding"
+	"x/json"
+)
+
+// Limits bound the envelopes a Codec decodes, see WithLimits. Zero fields don't
+// limit anything.
+type Limits struct {
+	// MaxEnvelopeSize is the maximum size of an envelope in bytes. No more of an
+	// envelope is read from an io.Reader.
+	MaxEnvelopeSize int64
+	// MaxBodySize is the maximum size of the data of an envelope in bytes.
+	MaxBodySize int64
+	// MaxDepth is the maximum nesting depth of arrays and objects in envelopes,
+	// the envelope itself being the first level.
+	MaxDepth int
+	// MaxStringLength is the maximum length in bytes of strings and object keys
+	// in envelopes, as encoded.
+	MaxStringLength int
+}
+
+// WithLimits makes the Codec fail to decode envelopes exceeding l, with a
+// DecodeError of kind ErrTooLarge or ErrTooDeep. Envelopes written with a JSON
+// driver are checked as they are read, see json.LimitDriver, those of other
+// drivers by the driver, see encoding.Limiter. Drivers that are neither fail to
+// decode anything if MaxDepth or MaxStringLength is set.
+func WithLimits(l Limits) Option {
+	return func(c *Codec) {
+		c.limits = l
+	}
+}
+
+// limitDriver returns the driver of c made to check the limits of c.
+func (c Codec) limitDriver() json.Driver {
+	d := c.dataDriver()
+	if isJSON(d) {
+		l := json.Limits{
+			MaxSize:         c.limits.MaxEnvelopeSize,
+			MaxDepth:        c.limits.MaxDepth,
+			MaxStringLength: c.limits.MaxStringLength,
+		}
+		if l == (json.Limits{}) {
+			return d
+		}
+		return json.Limit(d, l)
+	}
+	l := encoding.Limits{MaxDepth: c.limits.MaxDepth, MaxStringLength: c.limits.MaxStringLength}
+	if l == (encoding.Limits{}) {
+		return d
+	}
+	if ld, ok := d.(encoding.Limiter); ok {
+		return ld.Limit(l)
+	}
+	return unlimitedDriver{Driver: d}
+}
+
+// unlimitedDriver fails to decode anything, as Driver cannot check the limits
+// of the Codec.
+type unlimitedDriver struct {
+	json.Driver
+}
+
+func (d unlimitedDriver) err() error {
+	return fmt.Errorf("%s driver cannot limit the depth or string length of envelopes", encoding.ContentType(d.Driver))
+}
+
+func (d unlimitedDriver) Unmarshal(data []byte, v interface{}) error {
+	return d.err()
+}
+
+func (d unlimitedDriver) DecodeStream(r io.Reader, v interface{}) error {
+	return d.err()
+}
+
+func (d unlimitedDriver) ContentType() string {
+	return encoding.ContentType(d.Driver)
+}
+
+// checkSize checks the size of the envelope raw.
+func (c Codec) checkSize(raw []byte) error {
+	if max := c.limits.MaxEnvelopeSize; max > 0 && int64(len(raw)) > max {
+		return newDecodeErr(ErrTooLarge, "", fmt.Errorf("envelope of more than %d bytes", max))
+	}
+	return nil
+}
+
+// checkBody checks the size of the data of op.
+func (c Codec) checkBody(op envelope) error {
+	if max := c.limits.MaxBodySize; max > 0 && int64(len(op.Data)) > max {
+		return newDecodeErr(ErrTooLarge, op.T, fmt.Errorf("data of more than %d bytes", max))
+	}
+	return nil
+}
+
+// limitReader reads from r up to the offset max, after which it fails with err.
+// n is the offset of r.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	max int64
+	// size is the limit max was set for.
+	size int64
+	err  error
+}
+
+// newLimitReader returns a limitReader reading an envelope from r, or nil if
+// the size of envelopes is not limited.
+func (c Codec) newLimitReader(r io.Reader) *limitReader {
+	size := c.limits.MaxEnvelopeSize
+	if size <= 0 {
+		return nil
+	}
+	return &limitReader{r: r, max: size, size: size}
+}
+
+// reset allows reading an envelope starting at offset.
+func (r *limitReader) reset(offset int64) {
+	r.max = offset + r.size
+}
+
+func (r *limitReader) Read(p []byte) (int, error) {
+	if r.n >= r.max {
+		r.err = fmt.Errorf("envelope of more than %d bytes", r.size)
+		return 0, r.err
+	}
+	if int64(len(p)) > r.max-r.n {
+		p = p[:r.max-r.n]
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
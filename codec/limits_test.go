@@ -0,0 +1,190 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"x/encoding/cbor"
+	"x/json"
+)
+
+func TestCodec_Limits(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	limits := Limits{MaxEnvelopeSize: 64, MaxBodySize: 24, MaxDepth: 2, MaxStringLength: 16}
+	tests := []struct {
+		name     string
+		opts     []Option
+		data     string
+		wantErr  error
+		wantType CType
+	}{
+		{
+			name: "OK",
+			data: `{"T":"__codec.Test","Data":{"Data":"test"}}`,
+		},
+		{
+			name:    "Envelope",
+			data:    `{"T":"__codec.Test","Data":{"Data":"test"},"Padding":[1,2,3,4,5,6,7,8,9]}`,
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:     "Body",
+			data:     `{"T":"__codec.Test","Data":{"Data":"test","X":12345678}}`,
+			wantErr:  ErrTooLarge,
+			wantType: "__codec.Test",
+		},
+		{
+			name:    "Depth",
+			data:    `{"T":"__codec.Test","Data":{"Data":[[]]}}`,
+			wantErr: ErrTooDeep,
+		},
+		{
+			name:    "String",
+			data:    `{"T":"__codec.Test","Data":{"Data":"a long string!!!!"}}`,
+			wantErr: ErrTooLarge,
+		},
+		{
+			name: "CBOR",
+			opts: []Option{WithDriver(cbor.Driver{})},
+			data: cborEnvelope(t, &TestPayload{Data: "test"}),
+		},
+		{
+			name:    "CBOREnvelope",
+			opts:    []Option{WithDriver(cbor.Driver{})},
+			data:    cborEnvelope(t, &TestPayload{Data: strings.Repeat("a", 64)}),
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "CBORDepth",
+			opts:    []Option{WithDriver(cbor.Driver{})},
+			data:    cborData(t, map[string]interface{}{"T": "__codec.Test", "Data": map[string]interface{}{"Data": "test", "X": [][]int{{1}}}}),
+			wantErr: ErrTooDeep,
+		},
+		{
+			name:    "CBORString",
+			opts:    []Option{WithDriver(cbor.Driver{})},
+			data:    cborEnvelope(t, &TestPayload{Data: "a long string!!!!"}),
+			wantErr: ErrTooLarge,
+		},
+		{
+			name:    "Unlimited",
+			opts:    []Option{WithDriver(basicDriver{cbor.Driver{}})},
+			data:    cborEnvelope(t, &TestPayload{Data: "test"}),
+			wantErr: ErrMalformedEnvelope,
+		},
+		{
+			name:     "Binary",
+			opts:     []Option{WithSchema(SchemaBinary)},
+			data:     binaryEnvelope(t, reg, &TestPayload{Data: strings.Repeat("a", 24)}),
+			wantErr:  ErrTooLarge,
+			wantType: "__codec.Test",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(reg, append(tt.opts, WithLimits(limits))...)
+			check := func(name string, err error) {
+				t.Helper()
+				var de *DecodeError
+				if !errors.Is(err, tt.wantErr) || (err != nil && (!errors.As(err, &de) || de.Type != tt.wantType)) {
+					t.Errorf("%s error = %v, want %v", name, err, tt.wantErr)
+				}
+			}
+			_, err := c.Decode(tt.data)
+			check("Decode()", err)
+			_, err = c.Decode(strings.NewReader(tt.data))
+			check("Decode(io.Reader)", err)
+			_, err = c.NewDecoder(strings.NewReader(tt.data + tt.data)).Decode()
+			check("Decoder.Decode()", err)
+		})
+	}
+}
+
+func TestDecoder_Limits(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	c := NewCodec(reg, WithLimits(Limits{MaxEnvelopeSize: 64, MaxBodySize: 20}))
+	small := `{"T":"__codec.Test","Data":{"Data":"test"}}` + "\n"
+	large := `{"T":"__codec.Test","Data":{"Data":"a large body"}}` + "\n"
+	dec := c.NewDecoder(strings.NewReader(small + large + small + strings.Repeat(" ", 64) + small))
+
+	// Envelopes with large bodies are skipped, the size of envelopes counts
+	// from the end of the previous one.
+	for i, wantErr := range []error{nil, ErrTooLarge, nil, ErrTooLarge} {
+		if _, err := dec.Decode(); !errors.Is(err, wantErr) {
+			t.Errorf("Decode() #%d error = %v, want %v", i, err, wantErr)
+		}
+	}
+	if dec.Err() == nil {
+		t.Errorf("Err() = nil")
+	}
+}
+
+func TestDecodeError_Limits(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	tests := []struct {
+		opts []Option
+		data string
+		want string
+	}{
+		{
+			data: `{"T":"__codec.Test","Data":{"Data":[[]]}}`,
+			want: "json: nested too deeply: more than 2 levels",
+		},
+		{
+			opts: []Option{WithDriver(cbor.Driver{})},
+			data: cborData(t, map[string]interface{}{"T": "__codec.Test", "Data": []string{"a long string!!!!"}}),
+			want: "cbor: too large: string longer than 16 bytes",
+		},
+		{
+			data: `{"T":"__codec.Test","Data":{"Data":"0123456789abcdef"}}`,
+			want: "too large for __codec.Test: data of more than 24 bytes",
+		},
+	}
+	for _, tt := range tests {
+		c := NewCodec(reg, append(tt.opts, WithLimits(Limits{MaxBodySize: 24, MaxDepth: 2, MaxStringLength: 16}))...)
+		if _, err := c.Decode(tt.data); err == nil || err.Error() != tt.want {
+			t.Errorf("Decode() error = %v, want %s", err, tt.want)
+		}
+	}
+}
+
+// basicDriver is a CBOR driver that is no encoding.Limiter.
+type basicDriver struct {
+	json.Driver
+}
+
+func (basicDriver) ContentType() string {
+	return cbor.ContentType
+}
+
+func cborData(t *testing.T, v interface{}) string {
+	t.Helper()
+	b, err := cbor.Marshal(v)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return string(b)
+}
+
+func cborEnvelope(t *testing.T, d Data) string {
+	t.Helper()
+	b, err := NewCodec(nil, WithDriver(cbor.Driver{})).Marshal(d)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	return string(b)
+}
+
+func binaryEnvelope(t *testing.T, reg *Registry, d Data) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := NewCodec(reg, WithSchema(SchemaBinary)).EncodeTo(&buf, d); err != nil {
+		t.Fatalf("EncodeTo() error = %v", err)
+	}
+	return buf.String()
+}
@@ -0,0 +1,92 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+
+	"x/json"
+)
+
+var ErrDuplicateMigration = errors.New("migration already registered")
+
+// Versioned is implemented by Data whose encoding changes over time. Version
+// returns the current version, starting at 1, which is written to the envelope.
+// Envelopes of older versions are upgraded with the Migrations registered for
+// the type before their data is decoded.
+//
+// Data that isn't Versioned has version 1, as have envelopes without a version.
+type Versioned interface {
+	Data
+	Version() int
+}
+
+func versionOf(d Data) int {
+	if v, ok := d.(Versioned); ok {
+		return v.Version()
+	}
+	return 1
+}
+
+// Migration upgrades the data of an envelope, as encoded by d, by one version.
+type Migration func(d json.Driver, data json.Raw) (json.Raw, error)
+
+// MapMigration returns a Migration changing the data decoded as a map.
+func MapMigration(f func(m map[string]any) error) Migration {
+	return func(d json.Driver, data json.Raw) (json.Raw, error) {
+		var m map[string]any
+		if err := d.Unmarshal(data, &m); err != nil {
+			return nil, err
+		}
+		if m == nil {
+			m = map[string]any{}
+		}
+		if err := f(m); err != nil {
+			return nil, err
+		}
+		return d.Marshal(m)
+	}
+}
+
+type migrationKey struct {
+	T    CType
+	From int
+}
+
+// RegisterMigration registers m to upgrade the data of t from version from to
+// version from+1. Only one Migration may be registered per version, otherwise
+// ErrDuplicateMigration is returned.
+func (reg *Registry) RegisterMigration(t CType, from int, m Migration) error {
+	if from < 1 {
+		return fmt.Errorf("invalid version %d", from)
+	}
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	k := migrationKey{T: t, From: from}
+	if _, ok := reg.migrations[k]; ok {
+		return fmt.Errorf("%w: %s from version %d", ErrDuplicateMigration, t, from)
+	}
+	reg.migrations[k] = m
+	return nil
+}
+
+// migrate upgrades data of t from version from to version to.
+func (reg *Registry) migrate(d json.Driver, t CType, from, to int, data json.Raw) (json.Raw, error) {
+	if from > to {
+		return nil, fmt.Errorf("version %d is newer than %d", from, to)
+	}
+	reg.init()
+	for v := from; v < to; v++ {
+		reg.mu.RLock()
+		m := reg.migrations[migrationKey{T: t, From: v}]
+		reg.mu.RUnlock()
+		if m == nil {
+			return nil, fmt.Errorf("no migration from version %d", v)
+		}
+		var err error
+		if data, err = m(d, data); err != nil {
+			return nil, fmt.Errorf("from version %d: %w", v, err)
+		}
+	}
+	return data, nil
+}
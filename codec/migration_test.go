@@ -0,0 +1,156 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"x/encoding/cbor"
+	"x/json"
+)
+
+type TestVersionedPayload struct {
+	Name string
+	Tags []string
+}
+
+func (t *TestVersionedPayload) Type() CType {
+	return "__codec.Test"
+}
+
+func (t *TestVersionedPayload) Version() int {
+	return 3
+}
+
+func newVersionedRegistry(t *testing.T) *Registry {
+	t.Helper()
+	reg := NewRegistry()
+	if err := Register[TestVersionedPayload](reg); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterID(TypeOf[TestVersionedPayload](), 7); err != nil {
+		t.Fatal(err)
+	}
+	// Version 2 renamed Data to Name.
+	if err := reg.RegisterMigration("__codec.Test", 1, MapMigration(func(m map[string]any) error {
+		m["Name"] = m["Data"]
+		delete(m, "Data")
+		return nil
+	})); err != nil {
+		t.Fatal(err)
+	}
+	// Version 3 added Tags.
+	if err := reg.RegisterMigration("__codec.Test", 2, func(d json.Driver, data json.Raw) (json.Raw, error) {
+		var v TestVersionedPayload
+		if err := d.Unmarshal(data, &v); err != nil {
+			return nil, err
+		}
+		v.Tags = []string{"migrated"}
+		return d.Marshal(v)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return reg
+}
+
+func TestRegistry_RegisterMigration(t *testing.T) {
+	reg := newVersionedRegistry(t)
+	noop := func(d json.Driver, data json.Raw) (json.Raw, error) { return data, nil }
+	if err := reg.RegisterMigration("__codec.Test", 1, noop); !errors.Is(err, ErrDuplicateMigration) {
+		t.Errorf("RegisterMigration() error = %v, wantErr %v", err, ErrDuplicateMigration)
+	}
+	if err := reg.RegisterMigration("__codec.Test", 0, noop); err == nil {
+		t.Errorf("RegisterMigration() error = nil")
+	}
+	reg.Unregister("__codec.Test")
+	if err := reg.RegisterMigration("__codec.Test", 1, noop); err != nil {
+		t.Errorf("RegisterMigration() error = %v", err)
+	}
+}
+
+func TestCodec_Migrate(t *testing.T) {
+	want := &TestVersionedPayload{Name: "test", Tags: []string{"migrated"}}
+	tests := []struct {
+		name    string
+		input   string
+		want    Data
+		wantErr error
+	}{
+		{name: "V1", input: `{"T":"__codec.Test","Data":{"Data":"test"}}`, want: want},
+		{name: "V1Explicit", input: `{"T":"__codec.Test","V":1,"Data":{"Data":"test"}}`, want: want},
+		{name: "V2", input: `{"T":"__codec.Test","V":2,"Data":{"Name":"test"}}`, want: want},
+		{name: "V3", input: `{"T":"__codec.Test","V":3,"Data":{"Name":"test","Tags":["migrated"]}}`, want: want},
+		{name: "V4", input: `{"T":"__codec.Test","V":4,"Data":{"Name":"test"}}`, wantErr: ErrMigration},
+		{name: "V0", input: `{"T":"__codec.Test","V":0,"Data":{"Name":"test"}}`, wantErr: ErrMalformedEnvelope},
+		{name: "FailedMigration", input: `{"T":"__codec.Test","Data":[]}`, wantErr: ErrMigration},
+	}
+	c := NewCodec(newVersionedRegistry(t))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := c.Decode(tt.input)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got.D, tt.want) {
+				t.Errorf("Decode() = %v, want %v", got.D, tt.want)
+			}
+		})
+	}
+
+	reg := NewRegistry()
+	if err := Register[TestVersionedPayload](reg); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewCodec(reg).Decode(tests[0].input)
+	if want := "cannot migrate data for __codec.Test: no migration from version 1"; err == nil || err.Error() != want {
+		t.Errorf("Decode() error = %v, want %s", err, want)
+	}
+}
+
+func TestCodec_Version(t *testing.T) {
+	p := &TestVersionedPayload{Name: "test", Tags: []string{"a"}}
+	b, err := Marshal(p)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	if want := `{"T":"__codec.Test","V":3,"Data":{"Name":"test","Tags":["a"]}}`; string(b) != want {
+		t.Errorf("Marshal() = %s, want %s", b, want)
+	}
+	if _, err := NewCodec(nil, WithSchema(Schema{Type: "t", Data: "d"})).Marshal(p); err == nil {
+		t.Errorf("Marshal() without version key error = nil")
+	}
+
+	for _, opts := range [][]Option{
+		{WithSchema(SchemaInline)},
+		{WithSchema(SchemaBinary)},
+		{WithSchema(SchemaV2), WithDriver(cbor.Driver{})},
+	} {
+		c := NewCodec(newVersionedRegistry(t), opts...)
+		b, err := c.Marshal(p)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		got, err := c.Decode(b)
+		if err != nil {
+			t.Fatalf("Decode(%q) error = %v", b, err)
+		}
+		if !reflect.DeepEqual(got.D, p) {
+			t.Errorf("Decode(%q) = %v, want %v", b, got.D, p)
+		}
+	}
+
+	// A version 1 binary envelope has no flags, version 3 sets flagVersion.
+	c := NewCodec(newVersionedRegistry(t), WithSchema(SchemaBinary))
+	b, _ = c.Marshal(p)
+	if !bytes.HasPrefix(b, []byte{7, 1, 3}) {
+		t.Errorf("Marshal() = %q, want version 3", b)
+	}
+	got, err := c.Decode(append([]byte{7, 0, 15}, `{"Data":"test"}`...))
+	if want := (&TestVersionedPayload{Name: "test", Tags: []string{"migrated"}}); err != nil || !reflect.DeepEqual(got.D, want) {
+		t.Errorf("Decode() = %v, %v, want %v", got.D, err, want)
+	}
+	if _, err := c.Decode([]byte{7, 2, 0}); !errors.Is(err, ErrMalformedEnvelope) {
+		t.Errorf("Decode() error = %v, wantErr %v", err, ErrMalformedEnvelope)
+	}
+}
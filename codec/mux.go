@@ -0,0 +1,238 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+var ErrNoHandler = errors.New("no handler")
+
+// Handler handles a decoded envelope.
+type Handler func(ctx context.Context, p Payload) error
+
+// Middleware wraps a Handler, e.g. to log or recover.
+type Middleware func(next Handler) Handler
+
+// MessageError reports an envelope Serve could not decode or handle.
+type MessageError struct {
+	// Offset is the byte offset of the envelope in the stream, -1 if unknown.
+	Offset int64
+	// Type is the type of the envelope, if it could be read.
+	Type CType
+	Err  error
+}
+
+func (e *MessageError) Error() string {
+	var b strings.Builder
+	b.WriteString("message")
+	if e.Type != "" {
+		b.WriteString(" " + string(e.Type))
+	}
+	if e.Offset >= 0 {
+		fmt.Fprintf(&b, " at offset %d", e.Offset)
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+func (e *MessageError) Unwrap() error {
+	return e.Err
+}
+
+type MuxOption func(*Mux)
+
+// WithConcurrency lets Serve run up to n handlers at once. By default envelopes
+// are handled one after the other, in order.
+func WithConcurrency(n int) MuxOption {
+	return func(m *Mux) {
+		m.limit = n
+	}
+}
+
+// WithErrorHandler makes Serve report the envelopes it could not decode or
+// handle to fn and go on. By default Serve stops at the first error.
+func WithErrorHandler(fn func(ctx context.Context, err *MessageError)) MuxOption {
+	return func(m *Mux) {
+		m.onError = fn
+	}
+}
+
+// Mux dispatches decoded envelopes to the Handler registered for their type.
+// It is safe for concurrent use.
+type Mux struct {
+	c       Codec
+	limit   int
+	onError func(ctx context.Context, err *MessageError)
+
+	mu         sync.RWMutex
+	handlers   map[CType]Handler
+	middleware []Middleware
+	fallback   Handler
+}
+
+// NewMux returns a Mux decoding envelopes with c. If c has no Registry, a new
+// one is used.
+func NewMux(c Codec, opts ...MuxOption) *Mux {
+	if c.Unmarshal == nil {
+		c.Unmarshal = NewRegistry()
+	}
+	m := &Mux{c: c, limit: 1, handlers: map[CType]Handler{}}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if m.limit < 1 {
+		m.limit = 1
+	}
+	return m
+}
+
+// Handle registers fn to handle envelopes of T, which is added to the Registry
+// of the Mux unless its type is known already.
+func Handle[T any, PT DataPtr[T]](m *Mux, fn func(ctx context.Context, d PT) error) {
+	t := TypeOf[T, PT]()
+	if m.c.Unmarshal.Lookup(t) == nil {
+		// Lost races are harmless, the type is registered either way.
+		_ = Register[T, PT](m.c.Unmarshal)
+	}
+	m.HandleType(t, func(ctx context.Context, p Payload) error {
+		d, ok := p.D.(PT)
+		if !ok {
+			return fmt.Errorf("%w: got %T, want %T", ErrTypeMismatch, p.D, d)
+		}
+		return fn(ctx, d)
+	})
+}
+
+// HandleType registers h to handle envelopes of type t, replacing any Handler
+// registered for it before.
+func (m *Mux) HandleType(t CType, h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlers[t] = h
+}
+
+// Default sets the Handler of envelopes of types without a Handler of their
+// own, such as the UnknownPayloads kept by WithUnknown.
+func (m *Mux) Default(h Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = h
+}
+
+// Use adds middleware wrapping all handlers. The first middleware added is the
+// outermost one.
+func (m *Mux) Use(mw ...Middleware) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.middleware = append(m.middleware, mw...)
+}
+
+// Dispatch passes p to its Handler, through the middleware. Without a Handler,
+// the error is ErrNoHandler.
+func (m *Mux) Dispatch(ctx context.Context, p Payload) error {
+	m.mu.RLock()
+	h, ok := m.handlers[p.T]
+	if !ok {
+		h = m.fallback
+	}
+	mw := m.middleware
+	m.mu.RUnlock()
+	if h == nil {
+		h = func(context.Context, Payload) error {
+			return fmt.Errorf("%w for %s", ErrNoHandler, p.T)
+		}
+	}
+	for i := len(mw) - 1; i >= 0; i-- {
+		h = mw[i](h)
+	}
+	return h(ctx, p)
+}
+
+// Serve decodes the envelopes of r and dispatches them, until r ends or ctx is
+// canceled, which also interrupts reading r. Reads of readers without read
+// deadlines are then abandoned, see Codec.DecodeContext. Envelopes that cannot
+// be decoded or handled are reported to the error handler, see
+// WithErrorHandler, without one the first error stops Serve. A stream that
+// cannot be read any further always stops it. Errors are of type *MessageError,
+// except for the error of ctx. Serve waits for running handlers before it
+// returns.
+func (m *Mux) Serve(ctx context.Context, r io.Reader) error {
+	parent := ctx
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg    sync.WaitGroup
+		once  sync.Once
+		first error
+	)
+	report := func(err *MessageError) {
+		if m.onError != nil {
+			m.onError(ctx, err)
+			return
+		}
+		once.Do(func() {
+			first = err
+			cancel()
+		})
+	}
+
+	dispatch := func(p Payload, offset int64) {
+		if err := m.Dispatch(ctx, p); err != nil {
+			report(&MessageError{Offset: offset, Type: p.T, Err: err})
+		}
+	}
+
+	sem := make(chan struct{}, m.limit)
+	dec := m.c.NewDecoder(r)
+loop:
+	for ctx.Err() == nil {
+		p, err := dec.DecodeContext(ctx)
+		if err == io.EOF || errors.Is(err, ErrCanceled) {
+			break
+		}
+		if err != nil {
+			me := &MessageError{Offset: -1, Err: err}
+			var de *DecodeError
+			if errors.As(err, &de) {
+				me.Offset, me.Type = de.Offset, de.Type
+			}
+			report(me)
+			if dec.Err() != nil {
+				// The stream cannot be read any further.
+				once.Do(func() { first = me })
+				break
+			}
+			continue
+		}
+
+		if m.limit == 1 {
+			// Keep errors in stream order.
+			dispatch(p, dec.Offset())
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break loop
+		}
+		wg.Add(1)
+		go func(p Payload, offset int64) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			dispatch(p, offset)
+		}(p, dec.Offset())
+	}
+	wg.Wait()
+
+	if err := parent.Err(); err != nil {
+		return err
+	}
+	return first
+}
@@ -0,0 +1,163 @@
+package codec
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const muxStream = `{"T":"__codec.Test","Data":{"Data":"a"}}
+{"T":"__codec.TestEmpty","Data":{}}
+{"T":"__codec.TestUndefined","Data":{}}
+{"T":"__codec.Test","Data":{"Data":"b"}}
+`
+
+func TestMux_Serve(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		got   []string
+		errs  []*MessageError
+		trace []string
+	)
+	m := NewMux(NewCodec(nil), WithErrorHandler(func(ctx context.Context, err *MessageError) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, err)
+	}))
+	for _, name := range []string{"outer", "inner"} {
+		name := name
+		m.Use(func(next Handler) Handler {
+			return func(ctx context.Context, p Payload) error {
+				trace = append(trace, name)
+				return next(ctx, p)
+			}
+		})
+	}
+	Handle(m, func(ctx context.Context, d *TestPayload) error {
+		got = append(got, d.Data)
+		return nil
+	})
+	Handle(m, func(ctx context.Context, d *TestEmptyPayload) error {
+		return errors.New("failed")
+	})
+
+	if err := m.Serve(context.Background(), strings.NewReader(muxStream)); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("handled = %v, want %v", got, want)
+	}
+	if want := []string{"outer", "inner", "outer", "inner", "outer", "inner"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("middleware = %v, want %v", trace, want)
+	}
+	if len(errs) != 2 {
+		t.Fatalf("errors = %v, want 2", errs)
+	}
+	if errs[0].Type != "__codec.TestEmpty" || errs[0].Offset != 41 || errs[0].Err.Error() != "failed" {
+		t.Errorf("errors[0] = %+v", errs[0])
+	}
+	if errs[1].Type != "__codec.TestUndefined" || !errors.Is(errs[1], ErrUnknownType) {
+		t.Errorf("errors[1] = %+v", errs[1])
+	}
+}
+
+func TestMux_ServeStop(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestEmptyPayload](reg); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	m := NewMux(NewCodec(reg))
+	n := 0
+	Handle(m, func(ctx context.Context, d *TestPayload) error {
+		n++
+		return nil
+	})
+	err := m.Serve(context.Background(), strings.NewReader(muxStream))
+	var me *MessageError
+	if !errors.As(err, &me) || !errors.Is(err, ErrNoHandler) || me.Type != "__codec.TestEmpty" {
+		t.Errorf("Serve() error = %v, want %v", err, ErrNoHandler)
+	}
+	if n != 1 {
+		t.Errorf("handled %d envelopes, want 1", n)
+	}
+
+	m = NewMux(NewCodec(nil), WithErrorHandler(func(context.Context, *MessageError) {}))
+	err = m.Serve(context.Background(), strings.NewReader(`{"T":"__codec.Test","Data":{}}{`))
+	if !errors.As(err, &me) || !errors.Is(err, ErrMalformedEnvelope) {
+		t.Errorf("Serve() error = %v, want %v", err, ErrMalformedEnvelope)
+	}
+}
+
+func TestMux_Default(t *testing.T) {
+	m := NewMux(NewCodec(nil, WithUnknown(KeepUnknown)))
+	Handle(m, func(ctx context.Context, d *TestPayload) error { return nil })
+	var types []CType
+	m.Default(func(ctx context.Context, p Payload) error {
+		types = append(types, p.T)
+		return nil
+	})
+	if err := m.Serve(context.Background(), strings.NewReader(muxStream)); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	if want := []CType{"__codec.TestEmpty", "__codec.TestUndefined"}; !reflect.DeepEqual(types, want) {
+		t.Errorf("default types = %v, want %v", types, want)
+	}
+}
+
+func TestMux_Concurrency(t *testing.T) {
+	const limit = 3
+	var running, peak int32
+	m := NewMux(NewCodec(nil), WithConcurrency(limit))
+	Handle(m, func(ctx context.Context, d *TestPayload) error {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		return nil
+	})
+	stream := strings.Repeat(`{"T":"__codec.Test","Data":{}}`+"\n", 10)
+	if err := m.Serve(context.Background(), strings.NewReader(stream)); err != nil {
+		t.Fatalf("Serve() error = %v", err)
+	}
+	if peak < 2 || peak > limit {
+		t.Errorf("peak concurrency = %d, want 2..%d", peak, limit)
+	}
+}
+
+func TestMux_Canceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := NewMux(NewCodec(nil))
+	Handle(m, func(ctx context.Context, d *TestPayload) error {
+		cancel()
+		return nil
+	})
+	if err := m.Serve(ctx, strings.NewReader(muxStream)); err != context.Canceled {
+		t.Errorf("Serve() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestMessageError(t *testing.T) {
+	tests := []struct {
+		err  *MessageError
+		want string
+	}{
+		{err: &MessageError{Offset: 41, Type: "__codec.Test", Err: errors.New("failed")}, want: "message __codec.Test at offset 41: failed"},
+		{err: &MessageError{Offset: 0, Err: errors.New("failed")}, want: "message at offset 0: failed"},
+		{err: &MessageError{Offset: -1, Err: errors.New("failed")}, want: "message: failed"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.want {
+			t.Errorf("Error() = %q, want %q", got, tt.want)
+		}
+	}
+}
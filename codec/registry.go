@@ -0,0 +1,259 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+var (
+	ErrDuplicateType = errors.New("type already registered")
+	ErrDuplicateID   = errors.New("type id already registered")
+)
+
+// Registry maps every CType to the Func creating its Data, to the numeric id
+// used for it by the Binary layout, and to the Migrations of its data. Types may
+// also be known by aliases, e.g. their names before a rename. It is safe for
+// concurrent use, so types may be registered while decoding. The zero Registry
+// is ready to use, like one returned by NewRegistry.
+type Registry struct {
+	once  sync.Once
+	mu    sync.RWMutex
+	r     map[CType]Func
+	ids   map[CType]uint64
+	types map[uint64]CType
+
+	migrations map[migrationKey]Migration
+
+	aliases map[CType]CType
+	onAlias func(alias, t CType)
+
+	validators map[CType][]ValidateFunc
+}
+
+// NewRegistry returns a Registry holding only ErrorPayload, with type id 0.
+func NewRegistry() *Registry {
+	reg := &Registry{}
+	reg.init()
+	return reg
+}
+
+// init creates the maps of reg and registers ErrorPayload, once.
+func (reg *Registry) init() {
+	reg.once.Do(func() {
+		reg.r = map[CType]Func{}
+		reg.ids = map[CType]uint64{}
+		reg.types = map[uint64]CType{}
+		reg.migrations = map[migrationKey]Migration{}
+		reg.aliases = map[CType]CType{}
+		reg.validators = map[CType][]ValidateFunc{}
+
+		t := new(ErrorPayload).Type()
+		reg.r[t] = func() Data { return new(ErrorPayload) }
+		reg.ids[t], reg.types[0] = 0, t
+	})
+}
+
+// NewUnmarshal returns a Registry holding ErrorPayload and funcs, replacing
+// types registered more than once.
+//
+// Deprecated: Use NewRegistry and Register, which reports duplicate types.
+func NewUnmarshal(funcs ...Func) *Registry {
+	reg := NewRegistry()
+	reg.Add(funcs...)
+	return reg
+}
+
+// Register adds the types created by funcs. If any of them is registered
+// already, ErrDuplicateType is returned and none of them are added.
+func (reg *Registry) Register(funcs ...Func) error {
+	types := make([]CType, len(funcs))
+	for i, fn := range funcs {
+		types[i] = fn().Type()
+	}
+
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for i, t := range types {
+		if _, ok := reg.r[t]; ok {
+			return fmt.Errorf("%w: %s", ErrDuplicateType, t)
+		}
+		if _, ok := reg.aliases[t]; ok {
+			return fmt.Errorf("%w: %s is an alias", ErrDuplicateType, t)
+		}
+		for _, other := range types[:i] {
+			if t == other {
+				return fmt.Errorf("%w: %s", ErrDuplicateType, t)
+			}
+		}
+	}
+	for i, t := range types {
+		reg.r[t] = funcs[i]
+	}
+	return nil
+}
+
+// Add adds the types created by funcs, replacing any registered already.
+//
+// Deprecated: Use Register, which reports duplicate types.
+func (reg *Registry) Add(funcs ...Func) {
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	for _, fn := range funcs {
+		reg.r[fn().Type()] = fn
+	}
+}
+
+// RegisterID sets the type id of t. Neither t nor id may be registered with
+// another type id or type already, otherwise ErrDuplicateID is returned.
+func (reg *Registry) RegisterID(t CType, id uint64) error {
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if other, ok := reg.ids[t]; ok && other != id {
+		return fmt.Errorf("%w: %s has type id %d", ErrDuplicateID, t, other)
+	}
+	if other, ok := reg.types[id]; ok && other != t {
+		return fmt.Errorf("%w: %d is the type id of %s", ErrDuplicateID, id, other)
+	}
+	reg.ids[t], reg.types[id] = id, t
+	return nil
+}
+
+// Alias makes alias resolve to t, so envelopes written with the old name of a
+// renamed type keep decoding. The alias may not be registered as a type or as
+// an alias of another type, otherwise ErrDuplicateType is returned. Aliases of
+// aliases resolve to the final type.
+func (reg *Registry) Alias(alias, t CType) error {
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if current, ok := reg.aliases[t]; ok {
+		t = current
+	}
+	if alias == t {
+		return fmt.Errorf("%s cannot be an alias of itself", alias)
+	}
+	if _, ok := reg.r[alias]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateType, alias)
+	}
+	if other, ok := reg.aliases[alias]; ok && other != t {
+		return fmt.Errorf("%w: %s is an alias of %s", ErrDuplicateType, alias, other)
+	}
+	reg.aliases[alias] = t
+	// Keep aliases pointing to a type rather than to another alias.
+	for other, current := range reg.aliases {
+		if current == alias {
+			reg.aliases[other] = t
+		}
+	}
+	return nil
+}
+
+// OnAlias sets a function called whenever an envelope is decoded whose type is
+// an alias, e.g. to warn about deprecated names still in use.
+func (reg *Registry) OnAlias(fn func(alias, t CType)) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.onAlias = fn
+}
+
+// Unregister removes t, its type id, its Migrations and validators, and the
+// aliases of or to it, and reports whether t was registered.
+func (reg *Registry) Unregister(t CType) bool {
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	_, ok := reg.r[t]
+	delete(reg.r, t)
+	if id, ok := reg.ids[t]; ok {
+		delete(reg.ids, t)
+		delete(reg.types, id)
+	}
+	for k := range reg.migrations {
+		if k.T == t {
+			delete(reg.migrations, k)
+		}
+	}
+	delete(reg.validators, t)
+	for alias, current := range reg.aliases {
+		if alias == t || current == t {
+			delete(reg.aliases, alias)
+		}
+	}
+	return ok
+}
+
+// Lookup returns the Func registered for t, or for the type t is an alias of,
+// or nil.
+func (reg *Registry) Lookup(t CType) Func {
+	_, fn := reg.resolve(t)
+	return fn
+}
+
+// resolve returns the type t is an alias of, or t, and its Func.
+func (reg *Registry) resolve(t CType) (CType, Func) {
+	if reg == nil {
+		return t, nil
+	}
+	reg.init()
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if current, ok := reg.aliases[t]; ok {
+		t = current
+	}
+	return t, reg.r[t]
+}
+
+// aliased reports the use of alias for t to the function set with OnAlias.
+func (reg *Registry) aliased(alias, t CType) {
+	reg.mu.RLock()
+	fn := reg.onAlias
+	reg.mu.RUnlock()
+	if fn != nil {
+		fn(alias, t)
+	}
+}
+
+// ID returns the type id of t, or of the type t is an alias of.
+func (reg *Registry) ID(t CType) (uint64, bool) {
+	if reg == nil {
+		return 0, false
+	}
+	reg.init()
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	if current, ok := reg.aliases[t]; ok {
+		t = current
+	}
+	id, ok := reg.ids[t]
+	return id, ok
+}
+
+// TypeByID returns the type with the type id id.
+func (reg *Registry) TypeByID(id uint64) (CType, bool) {
+	if reg == nil {
+		return "", false
+	}
+	reg.init()
+	reg.mu.RLock()
+	defer reg.mu.RUnlock()
+	t, ok := reg.types[id]
+	return t, ok
+}
+
+// Types returns all registered types in order.
+func (reg *Registry) Types() []CType {
+	reg.init()
+	reg.mu.RLock()
+	types := make([]CType, 0, len(reg.r))
+	for t := range reg.r {
+		types = append(types, t)
+	}
+	reg.mu.RUnlock()
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
+}
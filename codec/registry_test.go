@@ -0,0 +1,258 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"x/json"
+)
+
+func TestRegistry_Register(t *testing.T) {
+	tests := []struct {
+		name      string
+		funcs     [][]Func
+		wantErr   error
+		wantTypes []CType
+	}{
+		{
+			name:      "Register",
+			funcs:     [][]Func{{func() Data { return new(TestPayload) }}},
+			wantTypes: []CType{"__codec.Error", "__codec.Test"},
+		},
+		{
+			name: "RegisterDuplicate",
+			funcs: [][]Func{
+				{func() Data { return new(TestPayload) }},
+				{func() Data { return new(TestUndefinedPayload) }, func() Data { return new(TestPayload) }},
+			},
+			wantErr:   ErrDuplicateType,
+			wantTypes: []CType{"__codec.Error", "__codec.Test"},
+		},
+		{
+			name: "RegisterDuplicateBatch",
+			funcs: [][]Func{
+				{func() Data { return new(TestPayload) }, func() Data { return new(TestPayload) }},
+			},
+			wantErr:   ErrDuplicateType,
+			wantTypes: []CType{"__codec.Error"},
+		},
+		{
+			name:      "RegisterErrorPayload",
+			funcs:     [][]Func{{func() Data { return new(ErrorPayload) }}},
+			wantErr:   ErrDuplicateType,
+			wantTypes: []CType{"__codec.Error"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reg := NewRegistry()
+			var err error
+			for _, funcs := range tt.funcs {
+				if err = reg.Register(funcs...); err != nil {
+					break
+				}
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := reg.Types(); !reflect.DeepEqual(got, tt.wantTypes) {
+				t.Errorf("Types() = %v, want %v", got, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestRegistry_Unregister(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Register(func() Data { return new(TestPayload) }); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if !reg.Unregister("__codec.Test") {
+		t.Errorf("Unregister() = false, want true")
+	}
+	if reg.Unregister("__codec.Test") {
+		t.Errorf("Unregister() = true, want false")
+	}
+	if fn := reg.Lookup("__codec.Test"); fn != nil {
+		t.Errorf("Lookup() = %v, want nil", fn)
+	}
+	if err := reg.Register(func() Data { return new(TestPayload) }); err != nil {
+		t.Errorf("Register() error = %v", err)
+	}
+}
+
+func TestRegistry_Zero(t *testing.T) {
+	for _, reg := range []*Registry{new(Registry), {}} {
+		if err := reg.Register(func() Data { return new(TestPayload) }); err != nil {
+			t.Fatalf("Register() error = %v", err)
+		}
+		if err := reg.RegisterID("__codec.Test", 7); err != nil {
+			t.Errorf("RegisterID() error = %v", err)
+		}
+		if err := reg.Alias("__codec.Old", "__codec.Test"); err != nil {
+			t.Errorf("Alias() error = %v", err)
+		}
+		if err := reg.RegisterMigration("__codec.Test", 1, func(d json.Driver, data json.Raw) (json.Raw, error) { return data, nil }); err != nil {
+			t.Errorf("RegisterMigration() error = %v", err)
+		}
+		reg.RegisterValidator("__codec.Test", func(Data) error { return nil })
+		if want := []CType{"__codec.Error", "__codec.Test"}; !reflect.DeepEqual(reg.Types(), want) {
+			t.Errorf("Types() = %v, want %v", reg.Types(), want)
+		}
+		if _, err := NewCodec(reg).Decode(`{"T":"__codec.Old","Data":{}}`); err != nil {
+			t.Errorf("Decode() error = %v", err)
+		}
+	}
+
+	var reg Registry
+	reg.Add(func() Data { return new(TestPayload) })
+	if reg.Lookup("__codec.Test") == nil || reg.Lookup("__codec.Error") == nil {
+		t.Errorf("Lookup() = nil")
+	}
+}
+
+func TestRegistry_AliasChain(t *testing.T) {
+	orders := [][][2]CType{
+		{{"__codec.Older", "__codec.Old"}, {"__codec.Old", "__codec.Test"}},
+		{{"__codec.Old", "__codec.Test"}, {"__codec.Older", "__codec.Old"}},
+	}
+	for _, aliases := range orders {
+		reg := newBinaryTestCodec(t).Unmarshal
+		for _, a := range aliases {
+			if err := reg.Alias(a[0], a[1]); err != nil {
+				t.Fatalf("Alias(%s, %s) error = %v", a[0], a[1], err)
+			}
+		}
+		for _, alias := range []CType{"__codec.Old", "__codec.Older"} {
+			if got, fn := reg.resolve(alias); got != "__codec.Test" || fn == nil {
+				t.Errorf("resolve(%s) = %s, %v, want __codec.Test", alias, got, fn)
+			}
+			if id, ok := reg.ID(alias); !ok || id != 7 {
+				t.Errorf("ID(%s) = %d, %v, want 7", alias, id, ok)
+			}
+		}
+	}
+
+	reg := NewRegistry()
+	if err := reg.Alias("__codec.A", "__codec.B"); err != nil {
+		t.Fatalf("Alias() error = %v", err)
+	}
+	if err := reg.Alias("__codec.B", "__codec.A"); err == nil {
+		t.Errorf("Alias() making a cycle error = nil")
+	}
+}
+
+func TestRegistry_Alias(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestPayload](reg); err != nil {
+		t.Fatal(err)
+	}
+	if err := reg.RegisterID("__codec.Test", 7); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		alias, t CType
+		wantErr  error
+	}{
+		{alias: "__codec.Old", t: "__codec.Test"},
+		{alias: "__codec.Older", t: "__codec.Old"},
+		{alias: "__codec.Old", t: "__codec.Test"},
+		{alias: "__codec.Old", t: "__codec.Error", wantErr: ErrDuplicateType},
+		{alias: "__codec.Error", t: "__codec.Test", wantErr: ErrDuplicateType},
+	}
+	for _, tt := range tests {
+		if err := reg.Alias(tt.alias, tt.t); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Alias(%s, %s) error = %v, wantErr %v", tt.alias, tt.t, err, tt.wantErr)
+		}
+	}
+	if err := reg.Alias("__codec.Test", "__codec.Old"); err == nil {
+		t.Errorf("Alias() to itself error = nil")
+	}
+	if err := reg.Register(func() Data { return &TestDynamicPayload{T: "__codec.Old"} }); !errors.Is(err, ErrDuplicateType) {
+		t.Errorf("Register() error = %v, wantErr %v", err, ErrDuplicateType)
+	}
+
+	for _, alias := range []CType{"__codec.Old", "__codec.Older"} {
+		if reg.Lookup(alias) == nil {
+			t.Errorf("Lookup(%s) = nil", alias)
+		}
+		if id, ok := reg.ID(alias); !ok || id != 7 {
+			t.Errorf("ID(%s) = %d, %v, want 7", alias, id, ok)
+		}
+	}
+
+	var used []CType
+	reg.OnAlias(func(alias, t CType) { used = append(used, alias, t) })
+	p, err := NewCodec(reg).Decode(`{"T":"__codec.Older","Data":{"Data":"test"}}`)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if p.T != "__codec.Test" || !reflect.DeepEqual(p.D, &TestPayload{Data: "test"}) {
+		t.Errorf("Decode() = %v", p)
+	}
+	if want := []CType{"__codec.Older", "__codec.Test"}; !reflect.DeepEqual(used, want) {
+		t.Errorf("OnAlias() called with %v, want %v", used, want)
+	}
+
+	c := NewCodec(reg, WithTypeAlias("__codec.Test", "__codec.Old"), WithSchema(SchemaV2))
+	b, err := c.Marshal(&TestPayload{Data: "test"})
+	if want := `{"type":"__codec.Old","data":{"Data":"test"}}`; err != nil || string(b) != want {
+		t.Errorf("Marshal() = %s, %v, want %s", b, err, want)
+	}
+	if b, err := NewCodec(reg).Marshal(&TestPayload{}); err != nil || !strings.Contains(string(b), `"__codec.Test"`) {
+		t.Errorf("Marshal() = %s, %v, want the type", b, err)
+	}
+
+	reg.Unregister("__codec.Test")
+	if reg.Lookup("__codec.Old") != nil {
+		t.Errorf("Lookup() after Unregister() = non-nil")
+	}
+}
+
+func TestRegistry_Concurrent(t *testing.T) {
+	reg := NewRegistry()
+	if err := reg.Register(func() Data { return new(TestPayload) }); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	c := NewCodec(reg)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				p := c.DecodeFrom([]byte("{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"))
+				if _, ok := p.D.(*TestPayload); !ok {
+					t.Errorf("DecodeFrom() = %T, want %T", p.D, &TestPayload{})
+					return
+				}
+			}
+		}()
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fn := func() Data { return &TestDynamicPayload{T: CType(fmt.Sprintf("__codec.Dynamic%d", i))} }
+				if err := reg.Register(fn); err != nil {
+					t.Errorf("Register() error = %v", err)
+					return
+				}
+				reg.Types()
+				reg.Unregister(fn().Type())
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+type TestDynamicPayload struct {
+	T CType
+}
+
+func (t *TestDynamicPayload) Type() CType {
+	return t.T
+}
@@ -0,0 +1,306 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"x/json"
+)
+
+// Layout selects how the type and the data are arranged in an envelope.
+type Layout uint8
+
+const (
+	// Wrapped envelopes hold the type and the data under keys of their own,
+	// {"type":...,"data":{...}}.
+	Wrapped Layout = iota
+	// Inline envelopes add the type as a discriminator key to the data, which
+	// has to be a JSON object, {"type":...,...}. The data must not have a key of
+	// the same name itself, nor one named like the version key.
+	Inline
+	// Binary envelopes are not JSON. They hold the numeric id of the type, as
+	// registered with Registry.RegisterID, and the length of the data before
+	// the data itself, see binary.go. They don't use any keys.
+	Binary
+)
+
+// Schema describes the layout and the keys of an envelope on the wire.
+type Schema struct {
+	Layout Layout
+	Type   string
+	// Data is the key of the data in Wrapped envelopes, unused by Inline ones.
+	Data string
+	// Version is the key of the version of the data, which is only written for
+	// Versioned data past version 1.
+	Version string
+	// Digest and Signature are the keys of the integrity fields of Wrapped
+	// envelopes, see WithChecksum and WithSigningKey.
+	Digest    string
+	Signature string
+}
+
+var (
+	// SchemaV1 is the original envelope format, {"T":...,"Data":...}. It is
+	// used by default.
+	SchemaV1 = Schema{Type: "T", Data: "Data", Version: "V", Digest: "Sum", Signature: "Sig"}
+	// SchemaV2 is the envelope format with lower case keys,
+	// {"type":...,"data":...}, as used by CloudEvents.
+	SchemaV2 = Schema{Type: "type", Data: "data", Version: "version", Digest: "digest", Signature: "signature"}
+	// SchemaInline is the inline envelope format with a "type" discriminator.
+	SchemaInline = Schema{Layout: Inline, Type: "type", Version: "version"}
+	// SchemaBinary is the binary envelope format.
+	SchemaBinary = Schema{Layout: Binary}
+)
+
+// write writes op to buf with d. If sealer is not nil, it computes the integrity
+// fields written along with the data.
+func (s Schema) write(d json.Driver, buf *bytes.Buffer, op envelope, sealer func(envelope, []byte) (seal, error)) error {
+	if op.V > 1 && s.Version == "" {
+		return fmt.Errorf("%s has version %d, but the schema has no version key", op.T, op.V)
+	}
+	if sealer != nil && s.Layout != Wrapped {
+		return fmt.Errorf("integrity fields need the Wrapped layout")
+	}
+	if !isJSON(d) {
+		return s.writeMap(d, buf, op, sealer)
+	}
+
+	var scratch [64]byte
+	n := buf.Len()
+	buf.WriteByte('{')
+	buf.Write(json.AppendQuote(scratch[:0], s.Type))
+	buf.WriteByte(':')
+	buf.Write(json.AppendQuote(scratch[:0], string(op.T)))
+	if op.V > 1 {
+		buf.WriteByte(',')
+		buf.Write(json.AppendQuote(scratch[:0], s.Version))
+		buf.WriteByte(':')
+		buf.Write(strconv.AppendInt(scratch[:0], int64(op.V), 10))
+	}
+	switch s.Layout {
+	case Wrapped:
+		buf.WriteByte(',')
+		buf.Write(json.AppendQuote(scratch[:0], s.Data))
+		buf.WriteByte(':')
+	case Inline:
+	default:
+		buf.Truncate(n)
+		return fmt.Errorf("unknown layout %d", s.Layout)
+	}
+
+	body := buf.Len()
+	if err := op.writeData(d, buf); err != nil {
+		buf.Truncate(n)
+		return err
+	}
+
+	if sealer != nil {
+		sl, err := sealer(op, buf.Bytes()[body:])
+		if err == nil {
+			err = s.writeSeal(sl, func(k, v string) {
+				buf.WriteByte(',')
+				buf.Write(json.AppendQuote(scratch[:0], k))
+				buf.WriteByte(':')
+				buf.Write(json.AppendQuote(scratch[:0], v))
+			})
+		}
+		if err != nil {
+			buf.Truncate(n)
+			return err
+		}
+	}
+
+	if s.Layout == Inline {
+		// Splice the data's members in after the discriminator.
+		data := buf.Bytes()[body:]
+		switch {
+		case len(data) < 2 || data[0] != '{':
+			buf.Truncate(n)
+			return fmt.Errorf("%s is not a JSON object and cannot be inlined", op.T)
+		case op.D == nil && s.hasKeys(d, data):
+			buf.Truncate(n)
+			return fmt.Errorf("the data of %s has the keys of the envelope and cannot be inlined", op.T)
+		case len(data) == 2:
+			buf.Truncate(body)
+		default:
+			data[0] = ','
+			buf.Truncate(buf.Len() - 1)
+		}
+	}
+	buf.WriteByte('}')
+	return nil
+}
+
+// hasKeys reports whether the data, e.g. of an envelope read with another
+// Schema, has the type or version key of s, which inlining it would duplicate.
+func (s Schema) hasKeys(d json.Driver, data []byte) bool {
+	var m map[string]json.Raw
+	return d.Unmarshal(data, &m) == nil && s.inlineKeys(m)
+}
+
+// inlineKeys reports whether m has the type or version key of s.
+func (s Schema) inlineKeys(m map[string]json.Raw) bool {
+	_, typ := m[s.Type]
+	_, version := m[s.Version]
+	return typ || version && s.Version != ""
+}
+
+// writeSeal writes the integrity fields sl with set.
+func (s Schema) writeSeal(sl seal, set func(k, v string)) error {
+	if sl.digest != nil {
+		if s.Digest == "" {
+			return fmt.Errorf("the schema has no digest key")
+		}
+		set(s.Digest, sl.digestString())
+	}
+	if sl.mac != nil {
+		if s.Signature == "" {
+			return fmt.Errorf("the schema has no signature key")
+		}
+		set(s.Signature, sl.signatureString())
+	}
+	return nil
+}
+
+// writeMap writes op as a map with d, for formats other than JSON.
+func (s Schema) writeMap(d json.Driver, buf *bytes.Buffer, op envelope, sealer func(envelope, []byte) (seal, error)) error {
+	t, err := d.Marshal(string(op.T))
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	if err := op.writeData(d, &data); err != nil {
+		return err
+	}
+
+	var m map[string]json.Raw
+	switch s.Layout {
+	case Wrapped:
+		m = map[string]json.Raw{s.Type: t, s.Data: data.Bytes()}
+	case Inline:
+		if err := d.Unmarshal(data.Bytes(), &m); err != nil || m == nil {
+			return fmt.Errorf("%s is not a map and cannot be inlined", op.T)
+		}
+		if op.D == nil && s.inlineKeys(m) {
+			return fmt.Errorf("the data of %s has the keys of the envelope and cannot be inlined", op.T)
+		}
+		m[s.Type] = t
+	default:
+		return fmt.Errorf("unknown layout %d", s.Layout)
+	}
+	if op.V > 1 {
+		if m[s.Version], err = d.Marshal(op.V); err != nil {
+			return err
+		}
+	}
+	if sealer != nil {
+		sl, err := sealer(op, data.Bytes())
+		if err != nil {
+			return err
+		}
+		err = s.writeSeal(sl, func(k, v string) {
+			if err == nil {
+				m[k], err = d.Marshal(v)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return d.EncodeStream(buf, m)
+}
+
+// parse reads an envelope written with s, see envelope.
+func (s Schema) parse(d json.Driver, raw []byte, strict bool) (op envelope, err error) {
+	var m map[string]json.Raw
+	if err = d.Unmarshal(raw, &m); err != nil {
+		return op, err
+	}
+	return s.envelope(d, m, raw, strict)
+}
+
+// unknownKey returns the first key of m, in sorted order, that is not a key of
+// s.
+func (s Schema) unknownKey(m map[string]json.Raw) (string, bool) {
+	var keys []string
+	for k := range m {
+		switch {
+		case k == s.Type, k == s.Data, k != "" && (k == s.Version || k == s.Digest || k == s.Signature):
+		case k == "D" && s == SchemaV1:
+		default:
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return "", false
+	}
+	sort.Strings(keys)
+	return keys[0], true
+}
+
+// envelope picks the parts of the envelope raw written with s from its decoded
+// keys m. Envelopes written with SchemaV1 are accepted by every Schema, and the
+// "D" key older versions wrote is ignored. Envelopes without a version key
+// leave op.V 0. If strict, Wrapped envelopes with other keys are rejected.
+func (s Schema) envelope(d json.Driver, m map[string]json.Raw, raw []byte, strict bool) (op envelope, err error) {
+	t, ok := m[s.Type]
+	if !ok {
+		if t, ok = m[SchemaV1.Type]; !ok {
+			return op, fmt.Errorf("envelope has no %q key", s.Type)
+		}
+		s = SchemaV1
+	}
+	if strict && s.Layout == Wrapped {
+		if k, ok := s.unknownKey(m); ok {
+			return op, &json.StrictError{Path: "$." + k, Err: json.ErrUnknownField}
+		}
+	}
+	if err = d.Unmarshal(t, &op.T); err != nil {
+		return op, fmt.Errorf("envelope type: %w", err)
+	}
+	if v, ok := m[s.Version]; ok && s.Version != "" {
+		if err = d.Unmarshal(v, &op.V); err != nil {
+			return op, fmt.Errorf("envelope version: %w", err)
+		}
+		if op.V < 1 {
+			return op, fmt.Errorf("invalid envelope version %d", op.V)
+		}
+	}
+	if op.seal, err = s.readSeal(d, m); err != nil {
+		return op, err
+	}
+	switch s.Layout {
+	case Wrapped:
+		op.Data = m[s.Data]
+	case Inline:
+		op.Data = raw
+	default:
+		return op, fmt.Errorf("unknown layout %d", s.Layout)
+	}
+	op.schema, op.driver = s, d
+	return op, nil
+}
+
+// readSeal reads the integrity fields of an envelope from its keys m.
+func (s Schema) readSeal(d json.Driver, m map[string]json.Raw) (sl seal, err error) {
+	var v string
+	if raw, ok := m[s.Digest]; ok && s.Digest != "" {
+		if err = d.Unmarshal(raw, &v); err != nil {
+			return sl, fmt.Errorf("envelope digest: %w", err)
+		}
+		if sl.sum, sl.digest, err = parseDigest(v); err != nil {
+			return sl, err
+		}
+	}
+	if raw, ok := m[s.Signature]; ok && s.Signature != "" {
+		if err = d.Unmarshal(raw, &v); err != nil {
+			return sl, fmt.Errorf("envelope signature: %w", err)
+		}
+		if sl.keyID, sl.mac, err = parseSignature(v); err != nil {
+			return sl, err
+		}
+	}
+	return sl, nil
+}
@@ -0,0 +1,168 @@
+package codec
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+type TestEmptyPayload struct{}
+
+func (t *TestEmptyPayload) Type() CType {
+	return "__codec.TestEmpty"
+}
+
+type TestScalarPayload string
+
+func (t TestScalarPayload) Type() CType {
+	return "__codec.TestScalar"
+}
+
+func TestSchema_Marshal(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  Schema
+		payload Data
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Default",
+			want: "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}",
+		},
+		{
+			name:   "SchemaV1",
+			schema: SchemaV1,
+			want:   "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}",
+		},
+		{
+			name:   "SchemaV2",
+			schema: SchemaV2,
+			want:   "{\"type\":\"__codec.Test\",\"data\":{\"Data\":\"test\"}}",
+		},
+		{
+			name:   "Custom",
+			schema: Schema{Type: "kind", Data: "payload"},
+			want:   "{\"kind\":\"__codec.Test\",\"payload\":{\"Data\":\"test\"}}",
+		},
+		{
+			name:   "Inline",
+			schema: SchemaInline,
+			want:   "{\"type\":\"__codec.Test\",\"Data\":\"test\"}",
+		},
+		{
+			name:   "InlineCustom",
+			schema: Schema{Layout: Inline, Type: "@kind"},
+			want:   "{\"@kind\":\"__codec.Test\",\"Data\":\"test\"}",
+		},
+		{
+			name:    "InlineEmpty",
+			schema:  SchemaInline,
+			payload: &TestEmptyPayload{},
+			want:    "{\"type\":\"__codec.TestEmpty\"}",
+		},
+		{
+			name:    "InlineScalar",
+			schema:  SchemaInline,
+			payload: TestScalarPayload("test"),
+			wantErr: true,
+		},
+		{
+			name:    "UnknownLayout",
+			schema:  Schema{Layout: 42, Type: "type"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(NewUnmarshal(
+				func() Data { return new(TestPayload) },
+				func() Data { return new(TestEmptyPayload) },
+			), WithSchema(tt.schema))
+			if tt.payload == nil {
+				tt.payload = &TestPayload{Data: "test"}
+			}
+			got, err := c.Marshal(tt.payload)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Marshal() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(got) != tt.want {
+				t.Errorf("Marshal() = %s, want %s", got, tt.want)
+			}
+			if p := c.DecodeFrom(got); !reflect.DeepEqual(p.D, tt.payload) {
+				t.Errorf("DecodeFrom() = %v, want %v", p.D, tt.payload)
+			}
+			if p := c.DecodeFrom(bytes.NewBuffer(got)); !reflect.DeepEqual(p.D, tt.payload) {
+				t.Errorf("DecodeFrom(io.Reader) = %v, want %v", p.D, tt.payload)
+			}
+		})
+	}
+}
+
+func TestSchema_DecodeFrom(t *testing.T) {
+	tests := []struct {
+		name    string
+		schema  Schema
+		r       string
+		want    Data
+		wantErr bool
+	}{
+		{
+			name:   "Legacy",
+			schema: SchemaV2,
+			r:      "{\"T\":\"__codec.Test\",\"D\":null,\"Data\":{\"Data\":\"test\"}}",
+			want:   &TestPayload{Data: "test"},
+		},
+		{
+			name:   "LegacyWithoutD",
+			schema: SchemaV2,
+			r:      "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}",
+			want:   &TestPayload{Data: "test"},
+		},
+		{
+			name:   "SchemaV2",
+			schema: SchemaV2,
+			r:      "{\"type\":\"__codec.Test\",\"data\":{\"Data\":\"test\"}}",
+			want:   &TestPayload{Data: "test"},
+		},
+		{
+			name:    "SchemaV2WithV1Decoder",
+			schema:  SchemaV1,
+			r:       "{\"type\":\"__codec.Test\",\"data\":{\"Data\":\"test\"}}",
+			wantErr: true,
+		},
+		{
+			name:   "Inline",
+			schema: SchemaInline,
+			r:      "{\"Data\":\"test\",\"type\":\"__codec.Test\"}",
+			want:   &TestPayload{Data: "test"},
+		},
+		{
+			name:   "InlineLegacy",
+			schema: SchemaInline,
+			r:      "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}",
+			want:   &TestPayload{Data: "test"},
+		},
+		{
+			name:    "NoType",
+			schema:  SchemaV2,
+			r:       "{\"data\":{\"Data\":\"test\"}}",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }), WithSchema(tt.schema))
+			got := c.DecodeFrom([]byte(tt.r))
+			if _, ok := got.D.(*ErrorPayload); ok != tt.wantErr {
+				t.Fatalf("DecodeFrom() = %v, wantErr %v", got.D, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got.D, tt.want) {
+				t.Errorf("DecodeFrom() = %v, want %v", got.D, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package codec
+
+import (
+	"io"
+	"io/fs"
+	"os"
+)
+
+// Source provides an envelope to Codec.Decode, for sources that have to be
+// opened first.
+type Source interface {
+	Open() (io.ReadCloser, error)
+}
+
+type sizedReaderAt interface {
+	io.ReaderAt
+	Size() int64
+}
+
+type fsSource struct {
+	fsys fs.FS
+	name string
+}
+
+func (s fsSource) Open() (io.ReadCloser, error) {
+	return s.fsys.Open(s.name)
+}
+
+// FromFS returns a Source reading the file name in fsys.
+func FromFS(fsys fs.FS, name string) Source {
+	return fsSource{fsys: fsys, name: name}
+}
+
+type fileSource string
+
+func (s fileSource) Open() (io.ReadCloser, error) {
+	return os.Open(string(s))
+}
+
+// FromFile returns a Source reading the file at path.
+func FromFile(path string) Source {
+	return fileSource(path)
+}
@@ -0,0 +1,71 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"x/json"
+)
+
+func TestCodec_DecodeSources(t *testing.T) {
+	const envelope = "{\"T\":\"__codec.Test\",\"Data\":{\"Data\":\"test\"}}"
+	path := filepath.Join(t.TempDir(), "envelope.json")
+	if err := os.WriteFile(path, []byte(envelope), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	fsys := fstest.MapFS{"envelope.json": {Data: []byte(envelope)}}
+	file, err := fsys.Open("envelope.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	tests := []struct {
+		name    string
+		r       any
+		wantErr error
+	}{
+		{name: "Bytes", r: []byte(envelope)},
+		{name: "Raw", r: json.Raw(envelope)},
+		{name: "String", r: envelope},
+		{name: "Buffer", r: *bytes.NewBufferString(envelope)},
+		{name: "BufferPtr", r: bytes.NewBufferString(envelope)},
+		{name: "ReaderAt", r: readerAt{strings.NewReader(envelope)}},
+		{name: "FSFile", r: file},
+		{name: "FS", r: FromFS(fsys, "envelope.json")},
+		{name: "File", r: FromFile(path)},
+		{name: "FileMissing", r: FromFile(path + ".missing"), wantErr: ErrOpenSource},
+		{name: "Unsupported", r: 42, wantErr: ErrUnsupportedSource},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(NewUnmarshal(func() Data { return new(TestPayload) }))
+			got, err := c.Decode(tt.r)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got.D, &TestPayload{Data: "test"}) {
+				t.Errorf("Decode() = %v, want %v", got.D, &TestPayload{Data: "test"})
+			}
+		})
+	}
+}
+
+// readerAt hides all methods of the strings.Reader but ReadAt and Size.
+type readerAt struct {
+	r *strings.Reader
+}
+
+func (r readerAt) ReadAt(p []byte, off int64) (int, error) {
+	return r.r.ReadAt(p, off)
+}
+
+func (r readerAt) Size() int64 {
+	return r.r.Size()
+}
@@ -0,0 +1,117 @@
+package codec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"x/encoding/cbor"
+	"x/json"
+)
+
+func TestCodec_WithStrict(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	tests := []struct {
+		name     string
+		opts     []Option
+		data     string
+		wantKind error
+		wantErr  error
+		wantPath string
+	}{
+		{
+			name: "OK",
+			data: `{"T":"__codec.Test","Data":{"Data":"test"}}`,
+		},
+		{
+			name: "Legacy",
+			data: `{"T":"__codec.Test","D":null,"Data":{"Data":"test"}}`,
+		},
+		{
+			name:     "EnvelopeKey",
+			data:     `{"T":"__codec.Test","Data":{"Data":"test"},"Extra":1}`,
+			wantKind: ErrMalformedEnvelope,
+			wantErr:  json.ErrUnknownField,
+			wantPath: "$.Extra",
+		},
+		{
+			name:     "EnvelopeDuplicate",
+			data:     `{"T":"__codec.Test","T":"__codec.Test","Data":{}}`,
+			wantKind: ErrMalformedEnvelope,
+			wantErr:  json.ErrDuplicateKey,
+			wantPath: "$.T",
+		},
+		{
+			name:     "BodyField",
+			opts:     []Option{WithSchema(SchemaV2)},
+			data:     `{"type":"__codec.Test","data":{"Data":"test","Extra":1}}`,
+			wantKind: ErrBodyDecode,
+			wantErr:  json.ErrUnknownField,
+			wantPath: "$.data.Extra",
+		},
+		{
+			name: "Inline",
+			opts: []Option{WithSchema(SchemaInline)},
+			data: `{"type":"__codec.Test","Data":"test"}`,
+		},
+		{
+			name:     "InlineField",
+			opts:     []Option{WithSchema(SchemaInline)},
+			data:     `{"type":"__codec.Test","Data":"test","Extra":1}`,
+			wantKind: ErrBodyDecode,
+			wantErr:  json.ErrUnknownField,
+			wantPath: "$.Extra",
+		},
+		{
+			name:     "CBOREnvelopeKey",
+			opts:     []Option{WithDriver(cbor.Driver{})},
+			data:     "\xa3aTl__codec.TestdData\xa0eExtra\x01",
+			wantKind: ErrMalformedEnvelope,
+			wantErr:  json.ErrUnknownField,
+			wantPath: "$.Extra",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(reg, append(tt.opts, WithStrict())...)
+			for _, r := range []any{tt.data, strings.NewReader(tt.data)} {
+				_, err := c.Decode(r)
+				var se *json.StrictError
+				if !errors.Is(err, tt.wantKind) || !errors.Is(err, tt.wantErr) || (err != nil && (!errors.As(err, &se) || se.Path != tt.wantPath)) {
+					t.Errorf("Decode(%T) error = %v, want %v: %v at %s", r, err, tt.wantKind, tt.wantErr, tt.wantPath)
+				}
+			}
+			if _, err := NewCodec(reg, tt.opts...).Decode(tt.data); err != nil {
+				t.Errorf("Decode() without WithStrict error = %v", err)
+			}
+		})
+	}
+}
+
+func TestCodec_WithStrictTrailing(t *testing.T) {
+	reg := newBinaryTestCodec(t).Unmarshal
+	const env = `{"T":"__codec.Test","Data":{"Data":"test"}}`
+	for _, opts := range [][]Option{nil, {WithSchema(SchemaBinary)}, {WithDriver(cbor.Driver{})}} {
+		c := NewCodec(reg, opts...)
+		b, err := c.Marshal(&TestPayload{Data: "test"})
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		b = append(b, "\n\x01"...)
+		if _, err := c.Decode(strings.NewReader(string(b))); err != nil {
+			t.Errorf("Decode() error = %v", err)
+		}
+		c = NewCodec(reg, append(opts, WithStrict())...)
+		if _, err := c.Decode(strings.NewReader(string(b))); !errors.Is(err, json.ErrTrailingData) {
+			t.Errorf("Decode() error = %v, want %v", err, json.ErrTrailingData)
+		}
+	}
+
+	// Streams hold many envelopes.
+	dec := NewCodec(reg, WithStrict()).NewDecoder(strings.NewReader(env + "\n" + env + "\n"))
+	for i := 0; i < 2; i++ {
+		if _, err := dec.Decode(); err != nil {
+			t.Errorf("Decode() error = %v", err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package codec
+
+import "io"
+
+// Transcode reads all envelopes from src with the Schema of from, and writes
+// them to dst with the Schema of to, e.g. to turn a stream of Binary envelopes
+// into readable NDJSON. The data of the envelopes is copied as it is, so both
+// Codecs need to use drivers of the same format, otherwise writing fails.
+//
+// Only the Registry of a Binary Codec is used, to map its type ids.
+func Transcode(dst io.Writer, src io.Reader, from, to Codec, opts ...EncoderOption) error {
+	return TranscodeFrom(dst, from.NewDecoder(src), to, opts...)
+}
+
+// TranscodeFrom transcodes the remaining envelopes of d like Transcode, e.g. to
+// read them with a DecoderOption such as WithInputFraming.
+func TranscodeFrom(dst io.Writer, d *Decoder, to Codec, opts ...EncoderOption) error {
+	e := to.NewEncoder(dst, opts...)
+	for {
+		op, err := d.next()
+		if err == io.EOF {
+			return e.Close()
+		}
+		if err == nil {
+			err = e.encode(op)
+		}
+		if err != nil {
+			e.Close()
+			return err
+		}
+	}
+}
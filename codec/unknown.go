@@ -0,0 +1,65 @@
+package codec
+
+import (
+	"x/json"
+)
+
+// UnknownPayload holds an envelope of a type missing from the Registry, as
+// kept by KeepUnknown. Encoded, it writes its data as it is, so it can be
+// forwarded or stored without being understood by Codecs with a driver of the
+// same format.
+type UnknownPayload struct {
+	T CType
+	// V is the version of the data, 0 if the envelope has none.
+	V int
+	// Data is the encoded data. For Inline envelopes it's the whole envelope.
+	Data json.Raw
+
+	// schema and driver are the Schema and driver the envelope was read with,
+	// see envelope.
+	schema Schema
+	driver json.Driver
+}
+
+func (u *UnknownPayload) Type() CType {
+	return u.T
+}
+
+func (u *UnknownPayload) Version() int {
+	return u.V
+}
+
+// UnknownFunc handles an envelope of a type missing from the Registry. It
+// returns the Data the envelope decodes to, usually u itself, or an error.
+type UnknownFunc func(u *UnknownPayload) (Data, error)
+
+// KeepUnknown is an UnknownFunc decoding envelopes of unknown types to their
+// UnknownPayload.
+func KeepUnknown(u *UnknownPayload) (Data, error) {
+	return u, nil
+}
+
+// WithUnknown makes envelopes of types missing from the Registry decode to the
+// result of fn, instead of failing with ErrUnknownType. Errors returned by fn
+// are reported as ErrUnknownType. Binary envelopes of unknown type ids still
+// fail, as their type cannot be told.
+func WithUnknown(fn UnknownFunc) Option {
+	return func(c *Codec) {
+		c.unknown = fn
+	}
+}
+
+// unknownPayload decodes op with the UnknownFunc of c.
+func (c Codec) unknownPayload(op envelope) (Payload, error) {
+	u := &UnknownPayload{T: op.T, V: op.V, schema: op.schema, driver: op.driver}
+	if op.Data != nil {
+		// op.Data may be held by a reused buffer.
+		u.Data = append(json.Raw{}, op.Data...)
+	}
+
+	d, err := c.unknown(u)
+	if err != nil {
+		return Payload{}, newDecodeErr(ErrUnknownType, op.T, err)
+	}
+	return Payload{T: op.T, D: d}, nil
+}
@@ -0,0 +1,126 @@
+package codec
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"x/json"
+)
+
+func TestCodec_KeepUnknown(t *testing.T) {
+	tests := []struct {
+		name   string
+		schema Schema
+		input  string
+		want   *UnknownPayload
+		// write is the Schema the envelope is written with, schema if not set.
+		write  *Schema
+		output string
+	}{
+		{
+			name:   "V1",
+			input:  `{"T":"__codec.Other","V":2,"Data":{"b": 1,  "a":[1, 2]}}`,
+			want:   &UnknownPayload{T: "__codec.Other", V: 2, Data: json.Raw(`{"b": 1,  "a":[1, 2]}`)},
+			output: `{"T":"__codec.Other","V":2,"Data":{"b": 1,  "a":[1, 2]}}`,
+		},
+		{
+			name:   "NoData",
+			schema: SchemaV2,
+			input:  `{"type":"__codec.Other"}`,
+			want:   &UnknownPayload{T: "__codec.Other"},
+			output: `{"type":"__codec.Other","data":null}`,
+		},
+		{
+			name:   "Inline",
+			schema: SchemaInline,
+			input:  `{"type":"__codec.Other","version":3,"a":1}`,
+			want:   &UnknownPayload{T: "__codec.Other", V: 3, Data: json.Raw(`{"type":"__codec.Other","version":3,"a":1}`)},
+			output: `{"type":"__codec.Other","version":3,"a":1}`,
+		},
+		{
+			name:   "InlineAsRead",
+			schema: SchemaInline,
+			input:  `{"b": [1, 2],"version":3,  "type":"__codec.Other","a":1}`,
+			want:   &UnknownPayload{T: "__codec.Other", V: 3, Data: json.Raw(`{"b": [1, 2],"version":3,  "type":"__codec.Other","a":1}`)},
+			output: `{"b": [1, 2],"version":3,  "type":"__codec.Other","a":1}`,
+		},
+		{
+			name:   "InlineToV2",
+			schema: SchemaInline,
+			input:  `{"type":"__codec.Other","version":3,"a":1}`,
+			want:   &UnknownPayload{T: "__codec.Other", V: 3, Data: json.Raw(`{"type":"__codec.Other","version":3,"a":1}`)},
+			write:  &SchemaV2,
+			output: `{"type":"__codec.Other","version":3,"data":{"a":1}}`,
+		},
+		{
+			name:   "InlineLegacy",
+			schema: SchemaInline,
+			input:  `{"T":"__codec.Other","Data":{"a":1,"type":"x","version":2}}`,
+			want:   &UnknownPayload{T: "__codec.Other", Data: json.Raw(`{"a":1,"type":"x","version":2}`)},
+			write:  &SchemaV1,
+			output: `{"T":"__codec.Other","Data":{"a":1,"type":"x","version":2}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCodec(NewRegistry(), WithSchema(tt.schema), WithUnknown(KeepUnknown))
+			p, err := c.Decode(tt.input)
+			if err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			u, ok := p.D.(*UnknownPayload)
+			if p.T != tt.want.T || !ok || u.T != tt.want.T || u.V != tt.want.V || !reflect.DeepEqual(u.Data, tt.want.Data) {
+				t.Errorf("Decode() = %v %+v, want %+v", p.T, p.D, tt.want)
+			}
+			if tt.write != nil {
+				c = NewCodec(NewRegistry(), WithSchema(*tt.write))
+			}
+			b, err := c.Marshal(p.D)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			if string(b) != tt.output {
+				t.Errorf("Marshal() = %s, want %s", b, tt.output)
+			}
+		})
+	}
+}
+
+func TestCodec_WithUnknown(t *testing.T) {
+	var routed []*UnknownPayload
+	errRejected := errors.New("rejected")
+	c := NewCodec(NewRegistry(), WithUnknown(func(u *UnknownPayload) (Data, error) {
+		routed = append(routed, u)
+		if u.T == "__codec.Rejected" {
+			return nil, errRejected
+		}
+		return u, nil
+	}))
+
+	dec := c.NewDecoder(strings.NewReader(`{"T":"__codec.A","Data":{"a":1}}
+{"T":"__codec.Rejected","Data":{}}
+{"T":"__codec.B","Data":{"bb":2}}
+`))
+	var got []Data
+	for dec.Next() {
+		got = append(got, dec.Payload().D)
+	}
+	if err := dec.Err(); err != nil {
+		t.Fatalf("Err() = %v", err)
+	}
+	if len(got) != 3 || len(routed) != 3 {
+		t.Fatalf("Next() = %v, routed %v", got, routed)
+	}
+	if got[0].(*UnknownPayload).Data.String() != `{"a":1}` || got[2].(*UnknownPayload).Data.String() != `{"bb":2}` {
+		t.Errorf("Payload() = %+v, %+v", got[0], got[2])
+	}
+	if err, ok := got[1].(*ErrorPayload); !ok || !strings.Contains(err.Error(), "rejected") {
+		t.Errorf("Payload() = %v, want the rejection", got[1])
+	}
+
+	if _, err := c.Decode(`{"T":"__codec.Rejected","Data":{}}`); !errors.Is(err, ErrUnknownType) || !errors.Is(err, errRejected) {
+		t.Errorf("Decode() error = %v, wantErr %v", err, errRejected)
+	}
+}
@@ -0,0 +1,85 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Validator is implemented by Data checking its own invariants. Validate is
+// called after decoding and before encoding, see also
+// Registry.RegisterValidator.
+type Validator interface {
+	Validate() error
+}
+
+// ValidateFunc checks the invariants of d.
+type ValidateFunc func(d Data) error
+
+// FieldError reports an invalid field by its path, e.g. "items[2].name".
+type FieldError struct {
+	Path string
+	Err  error
+}
+
+// Field returns a FieldError for the field name. A FieldError err is nested
+// under name, so validators of nested values can be composed. Names of array
+// elements are written as "[i]".
+func Field(name string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var fe *FieldError
+	if errors.As(err, &fe) && fe == err {
+		if strings.HasPrefix(fe.Path, "[") {
+			return &FieldError{Path: name + fe.Path, Err: fe.Err}
+		}
+		return &FieldError{Path: name + "." + fe.Path, Err: fe.Err}
+	}
+	return &FieldError{Path: name, Err: err}
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// RegisterValidator adds fn to the validators of t, which are called after its
+// own Validate method.
+func (reg *Registry) RegisterValidator(t CType, fn ValidateFunc) {
+	reg.init()
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.validators[t] = append(reg.validators[t], fn)
+}
+
+// validate checks d with its Validate method and the validators registered for
+// its type.
+func (reg *Registry) validate(d Data) error {
+	if v, ok := d.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return err
+		}
+	}
+	if reg == nil {
+		return nil
+	}
+	reg.init()
+	reg.mu.RLock()
+	fns := reg.validators[d.Type()]
+	reg.mu.RUnlock()
+	for _, fn := range fns {
+		if err := fn(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validationErr reports the invalid data of an encoded envelope.
+func validationErr(t CType, err error) error {
+	return fmt.Errorf("%w for %s: %w", ErrValidation, t, err)
+}
@@ -0,0 +1,123 @@
+package codec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var errRequired = errors.New("required")
+
+type TestValidItem struct {
+	Qty int
+}
+
+type TestValidPayload struct {
+	Name  string
+	Items []TestValidItem
+}
+
+func (t *TestValidPayload) Type() CType {
+	return "__codec.Valid"
+}
+
+func (t *TestValidPayload) Validate() error {
+	if t.Name == "" {
+		return Field("Name", errRequired)
+	}
+	for i, item := range t.Items {
+		if item.Qty <= 0 {
+			return Field("Items", Field(fmt.Sprintf("[%d]", i), Field("Qty", errors.New("must be positive"))))
+		}
+	}
+	return nil
+}
+
+func TestCodec_Validate(t *testing.T) {
+	reg := NewRegistry()
+	if err := Register[TestValidPayload](reg); err != nil {
+		t.Fatal(err)
+	}
+	reg.RegisterValidator("__codec.Valid", func(d Data) error {
+		if d.(*TestValidPayload).Name == "forbidden" {
+			return Field("Name", errors.New("forbidden"))
+		}
+		return nil
+	})
+	c := NewCodec(reg)
+
+	tests := []struct {
+		name     string
+		input    string
+		wantErr  error
+		wantPath string
+		wantMsg  string
+	}{
+		{name: "Valid", input: `{"T":"__codec.Valid","Data":{"Name":"a","Items":[{"Qty":1}]}}`},
+		{
+			name:     "Required",
+			input:    `{"T":"__codec.Valid","Data":{"Items":[]}}`,
+			wantErr:  errRequired,
+			wantPath: "Name",
+			wantMsg:  "invalid data for __codec.Valid: Name: required",
+		},
+		{
+			name:     "NoData",
+			input:    `{"T":"__codec.Valid"}`,
+			wantErr:  errRequired,
+			wantPath: "Name",
+		},
+		{
+			name:     "Nested",
+			input:    `{"T":"__codec.Valid","Data":{"Name":"a","Items":[{"Qty":1},{"Qty":0}]}}`,
+			wantErr:  ErrValidation,
+			wantPath: "Items[1].Qty",
+			wantMsg:  "invalid data for __codec.Valid: Items[1].Qty: must be positive",
+		},
+		{
+			name:     "Registered",
+			input:    `{"T":"__codec.Valid","Data":{"Name":"forbidden"}}`,
+			wantErr:  ErrValidation,
+			wantPath: "Name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := c.Decode(tt.input)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if _, err := c.Marshal(p.D); err != nil {
+					t.Errorf("Marshal() error = %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrValidation) || !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var fe *FieldError
+			if !errors.As(err, &fe) || fe.Path != tt.wantPath {
+				t.Errorf("Decode() error = %v, want path %s", err, tt.wantPath)
+			}
+			if tt.wantMsg != "" && err.Error() != tt.wantMsg {
+				t.Errorf("Decode() error = %q, want %q", err, tt.wantMsg)
+			}
+		})
+	}
+
+	buf := &bytes.Buffer{}
+	e := c.NewEncoder(buf)
+	if err := e.Encode(&TestValidPayload{Name: "forbidden"}); !errors.Is(err, ErrValidation) {
+		t.Errorf("Encode() error = %v, wantErr %v", err, ErrValidation)
+	}
+	_, err := Marshal(&TestValidPayload{Name: "a", Items: []TestValidItem{{}}})
+	var fe *FieldError
+	if !errors.Is(err, ErrValidation) || !errors.As(err, &fe) || fe.Path != "Items[0].Qty" {
+		t.Errorf("Marshal() error = %v, wantErr %v", err, ErrValidation)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("Encode() wrote %q", buf)
+	}
+}
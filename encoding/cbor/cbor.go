@@ -0,0 +1,82 @@
+// Package cbor implements the Concise Binary Object Representation (RFC 8949)
+// as an encoding.Driver.
+//
+// Go values are mapped like encoding/json maps them: `json` struct tags,
+// json.Marshaler/Unmarshaler and encoding.TextMarshaler/TextUnmarshaler are
+// honored, and json.Raw holds an undecoded CBOR item. Byte slices are encoded
+// as byte strings. Tags are ignored when decoding, indefinite-length items are
+// not supported.
+package cbor
+
+import (
+	"errors"
+	"io"
+
+	"x/encoding"
+	"x/encoding/internal/item"
+)
+
+// ContentType is the media type of CBOR.
+const ContentType = "application/cbor"
+
+var format = &item.Format{
+	Name:            "cbor",
+	ErrTrailingData: errors.New("cbor: trailing data after top-level item"),
+	NewReader:       func(data []byte) item.SliceReader { return &reader{b: data} },
+	NewWriter:       func() item.SliceWriter { return &writer{} },
+	ReadItem:        readItem,
+}
+
+// Driver is the CBOR encoding.Driver. It implements encoding.Limiter.
+type Driver struct {
+	// Limits bound the items decoded by the driver, see Limit.
+	Limits encoding.Limits
+}
+
+func (Driver) Marshal(v interface{}) ([]byte, error) {
+	return format.Marshal(v)
+}
+
+func (d Driver) Unmarshal(data []byte, v interface{}) error {
+	return format.Unmarshal(data, v, d.Limits)
+}
+
+func (d Driver) DecodeStream(r io.Reader, v interface{}) error {
+	return format.NewDecoder(r, d.Limits).Decode(v)
+}
+
+func (Driver) EncodeStream(w io.Writer, v interface{}) error {
+	return format.EncodeStream(w, v)
+}
+
+func (d Driver) NewDecoder(r io.Reader) encoding.Decoder {
+	return format.NewDecoder(r, d.Limits)
+}
+
+// Limit returns a Driver failing with encoding.ErrTooDeep or
+// encoding.ErrTooLarge for items exceeding l, before they are decoded.
+func (Driver) Limit(l encoding.Limits) encoding.Driver {
+	return Driver{Limits: l}
+}
+
+func (Driver) ContentType() string {
+	return ContentType
+}
+
+// Marshal returns the CBOR encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	return format.Marshal(v)
+}
+
+// Unmarshal decodes the CBOR item data into v. Items nested more than 10000
+// levels deep fail with encoding.ErrTooDeep.
+func Unmarshal(data []byte, v interface{}) error {
+	return format.Unmarshal(data, v, encoding.Limits{})
+}
+
+// Decoder reads successive CBOR items from an input stream.
+type Decoder = item.Decoder
+
+func NewDecoder(r io.Reader) *Decoder {
+	return format.NewDecoder(r, encoding.Limits{})
+}
@@ -0,0 +1,269 @@
+package cbor
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"x/encoding"
+	"x/json"
+	"x/json/option"
+)
+
+func TestMarshal(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{v: 0, want: "00"},
+		{v: 23, want: "17"},
+		{v: 24, want: "1818"},
+		{v: 1000, want: "1903e8"},
+		{v: uint64(math.MaxUint64), want: "1bffffffffffffffff"},
+		{v: -1, want: "20"},
+		{v: -1000, want: "3903e7"},
+		{v: 1.5, want: "fb3ff8000000000000"},
+		{v: float32(1.5), want: "fa3fc00000"},
+		{v: false, want: "f4"},
+		{v: true, want: "f5"},
+		{v: nil, want: "f6"},
+		{v: "IETF", want: "6449455446"},
+		{v: []byte{1, 2, 3, 4}, want: "4401020304"},
+		{v: []int{1, 2, 3}, want: "83010203"},
+		{v: map[string]int{"b": 2, "a": 1}, want: "a2616101616202"},
+		{v: json.Raw{0x01}, want: "01"},
+	}
+	for _, tt := range tests {
+		got, err := Marshal(tt.v)
+		if err != nil {
+			t.Errorf("Marshal(%#v) error = %v", tt.v, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("Marshal(%#v) = %x, want %s", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	tests := []struct {
+		data string
+		want interface{}
+	}{
+		{data: "00", want: int64(0)},
+		{data: "3903e7", want: int64(-1000)},
+		{data: "f93e00", want: 1.5},
+		{data: "fa3fc00000", want: 1.5},
+		{data: "f7", want: nil},
+		{data: "6449455446", want: "IETF"},
+		{data: "4401020304", want: []byte{1, 2, 3, 4}},
+		{data: "c074323031332d30332d32315432303a30343a30305a", want: "2013-03-21T20:04:00Z"},
+		{data: "83010203", want: []interface{}{int64(1), int64(2), int64(3)}},
+		{data: "a2616101616202", want: map[string]interface{}{"a": int64(1), "b": int64(2)}},
+	}
+	for _, tt := range tests {
+		b, _ := hex.DecodeString(tt.data)
+		var got interface{}
+		if err := Unmarshal(b, &got); err != nil {
+			t.Errorf("Unmarshal(%s) error = %v", tt.data, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestUnmarshal_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		v    interface{}
+	}{
+		{name: "truncated", data: "6449", v: new(string)},
+		{name: "trailing", data: "0000", v: new(int)},
+		{name: "indefinite", data: "9f01ff", v: new([]int)},
+		{name: "type", data: "6449455446", v: new(int)},
+		{name: "overflow", data: "190100", v: new(int8)},
+		{name: "long array", data: "9bffffffffffffffff", v: new([]int)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, _ := hex.DecodeString(tt.data)
+			if err := Unmarshal(b, tt.v); err == nil {
+				t.Errorf("Unmarshal(%s) error = nil", tt.data)
+			}
+		})
+	}
+}
+
+func TestUnmarshal_Depth(t *testing.T) {
+	nested := func(head []byte, n int) []byte {
+		return append(bytes.Repeat(head, n), 0x00)
+	}
+	var ok []interface{}
+	if err := Unmarshal(nested([]byte{0x81}, 100), &ok); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	tests := []struct {
+		data []byte
+		v    interface{}
+	}{
+		{data: nested([]byte{0x81}, 5000000), v: new(interface{})},
+		{data: nested([]byte{0x81}, 5000000), v: new([]interface{})},
+		{data: nested([]byte{0xa1, 0x00}, 20000), v: new(interface{})},
+		{data: nested([]byte{0xa1, 0x00}, 20000), v: new(map[int]interface{})},
+	}
+	for _, tt := range tests {
+		if err := Unmarshal(tt.data, tt.v); !errors.Is(err, encoding.ErrTooDeep) {
+			t.Errorf("Unmarshal(%T) error = %v, want %v", tt.v, err, encoding.ErrTooDeep)
+		}
+		if err := NewDecoder(bytes.NewReader(tt.data)).Decode(tt.v); !errors.Is(err, encoding.ErrTooDeep) {
+			t.Errorf("Decode(%T) error = %v, want %v", tt.v, err, encoding.ErrTooDeep)
+		}
+		var raw json.Raw
+		if err := Unmarshal(tt.data, &raw); err != nil {
+			t.Errorf("Unmarshal(json.Raw) error = %v", err)
+		}
+	}
+}
+
+func TestDriver_Limit(t *testing.T) {
+	d := Driver{}.Limit(encoding.Limits{MaxDepth: 2, MaxStringLength: 4})
+	tests := []struct {
+		v       interface{}
+		wantErr error
+	}{
+		{v: map[string]interface{}{"a": []string{"abcd"}}},
+		{v: map[string]interface{}{"a": [][]int{{1}}}, wantErr: encoding.ErrTooDeep},
+		{v: []string{"abcde"}, wantErr: encoding.ErrTooLarge},
+		{v: map[string]int{"abcde": 1}, wantErr: encoding.ErrTooLarge},
+		{v: [][]byte{[]byte("abcde")}, wantErr: encoding.ErrTooLarge},
+	}
+	for _, tt := range tests {
+		b, err := Marshal(tt.v)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		var raw json.Raw
+		if err := d.Unmarshal(b, &raw); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Unmarshal(%v) error = %v, want %v", tt.v, err, tt.wantErr)
+		}
+		if err := d.DecodeStream(bytes.NewReader(b), &raw); !errors.Is(err, tt.wantErr) {
+			t.Errorf("DecodeStream(%v) error = %v, want %v", tt.v, err, tt.wantErr)
+		}
+	}
+}
+
+type Embedded struct {
+	Shared string `json:"shared"`
+}
+
+type testStruct struct {
+	Embedded
+	Name     string            `json:"name"`
+	Count    int               `json:"count,omitempty"`
+	ID       int64             `json:"id,string"`
+	Skipped  string            `json:"-"`
+	Tags     []string          `json:"tags"`
+	Attrs    map[string]uint16 `json:"attrs,omitempty"`
+	Data     json.Raw          `json:"data"`
+	Nullable option.NullableString
+	Optional option.Int `json:",omitempty"`
+	Bool     option.NullableBool
+	Blob     []byte
+	private  int
+}
+
+func TestRoundTrip(t *testing.T) {
+	data, _ := Marshal(map[string]int{"x": 1})
+	want := testStruct{
+		Embedded: Embedded{Shared: "s"},
+		Name:     "test",
+		ID:       math.MaxInt64,
+		Tags:     []string{"a", "b"},
+		Attrs:    map[string]uint16{"k": 65535},
+		Data:     data,
+		Nullable: option.NewNullableString("value"),
+		Optional: option.NewInt(-7),
+		Bool:     option.NullableFalse,
+		Blob:     []byte{0, 1},
+	}
+	b, err := Marshal(want)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var got testStruct
+	if err := Unmarshal(b, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Unmarshal() = %+v, want %+v", got, want)
+	}
+
+	var m map[string]json.Raw
+	if err := Unmarshal(b, &m); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	for _, k := range []string{"count", "Skipped", "private"} {
+		if _, ok := m[k]; ok {
+			t.Errorf("key %q is encoded", k)
+		}
+	}
+	var id string
+	if err := Unmarshal(m["id"], &id); err != nil || id != "9223372036854775807" {
+		t.Errorf("id = %q, %v", id, err)
+	}
+	if !bytes.Equal(m["data"], data) {
+		t.Errorf("data = %x, want %x", m["data"], data)
+	}
+	if !bytes.Equal(m["Nullable"], []byte("\x65value")) {
+		t.Errorf("Nullable = %x", m["Nullable"])
+	}
+
+	got = testStruct{}
+	if err := Unmarshal(b[:len(b)-1], &got); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Unmarshal() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+	want := testStruct{Name: "test", Tags: []string{"a"}, Data: json.Raw{0xf5}}
+	buf := &bytes.Buffer{}
+	d := Driver{}
+	for i := 0; i < 2; i++ {
+		if err := d.EncodeStream(buf, want); err != nil {
+			t.Fatalf("EncodeStream() error = %v", err)
+		}
+	}
+	n := int64(buf.Len())
+	buf.WriteByte(0x82)
+
+	dec := d.NewDecoder(buf)
+	for i := 0; i < 2; i++ {
+		if !dec.More() {
+			t.Fatalf("More() = false")
+		}
+		var got testStruct
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Decode() = %+v, want %+v", got, want)
+		}
+	}
+	if dec.InputOffset() != n {
+		t.Errorf("InputOffset() = %d, want %d", dec.InputOffset(), n)
+	}
+	var got testStruct
+	if err := dec.Decode(&got); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if err := dec.Decode(&got); err != io.EOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.EOF)
+	}
+}
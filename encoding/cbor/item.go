@@ -0,0 +1,435 @@
+package cbor
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"x/encoding/internal/item"
+)
+
+const (
+	majorUint byte = iota
+	majorNegInt
+	majorBytes
+	majorText
+	majorArray
+	majorMap
+	majorTag
+	majorSimple
+)
+
+const (
+	simpleFalse = 20
+	simpleTrue  = 21
+	simpleNull  = 22
+	simpleUndef = 23
+	float16Info = 25
+	float32Info = 26
+	float64Info = 27
+)
+
+// maxCount bounds the length argument of containers, no valid input comes
+// close to it.
+const maxCount = 1 << 48
+
+var errIndefinite = errors.New("indefinite-length items are not supported")
+
+// writer implements item.SliceWriter.
+type writer struct {
+	b []byte
+}
+
+func (w *writer) Bytes() []byte {
+	return w.b
+}
+
+func (w *writer) head(major byte, n uint64) {
+	m := major << 5
+	switch {
+	case n < 24:
+		w.b = append(w.b, m|byte(n))
+	case n <= math.MaxUint8:
+		w.b = append(w.b, m|24, byte(n))
+	case n <= math.MaxUint16:
+		w.b = binary.BigEndian.AppendUint16(append(w.b, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		w.b = binary.BigEndian.AppendUint32(append(w.b, m|26), uint32(n))
+	default:
+		w.b = binary.BigEndian.AppendUint64(append(w.b, m|27), n)
+	}
+}
+
+func (w *writer) WriteNil() {
+	w.b = append(w.b, majorSimple<<5|simpleNull)
+}
+
+func (w *writer) WriteBool(b bool) {
+	if b {
+		w.b = append(w.b, majorSimple<<5|simpleTrue)
+	} else {
+		w.b = append(w.b, majorSimple<<5|simpleFalse)
+	}
+}
+
+func (w *writer) WriteInt(i int64) {
+	if i >= 0 {
+		w.head(majorUint, uint64(i))
+	} else {
+		w.head(majorNegInt, uint64(-1-i))
+	}
+}
+
+func (w *writer) WriteUint(u uint64) {
+	w.head(majorUint, u)
+}
+
+func (w *writer) WriteFloat32(f float32) {
+	w.b = binary.BigEndian.AppendUint32(append(w.b, majorSimple<<5|float32Info), math.Float32bits(f))
+}
+
+func (w *writer) WriteFloat64(f float64) {
+	w.b = binary.BigEndian.AppendUint64(append(w.b, majorSimple<<5|float64Info), math.Float64bits(f))
+}
+
+func (w *writer) WriteString(s string) {
+	w.head(majorText, uint64(len(s)))
+	w.b = append(w.b, s...)
+}
+
+func (w *writer) WriteBytes(b []byte) {
+	w.head(majorBytes, uint64(len(b)))
+	w.b = append(w.b, b...)
+}
+
+func (w *writer) WriteArrayHeader(n int) {
+	w.head(majorArray, uint64(n))
+}
+
+func (w *writer) WriteMapHeader(n int) {
+	w.head(majorMap, uint64(n))
+}
+
+func (w *writer) WriteRaw(b []byte) {
+	w.b = append(w.b, b...)
+}
+
+// head is the initial byte of an item and its argument.
+type head struct {
+	major byte
+	info  byte
+	arg   uint64
+	// n is the size of the head.
+	n int
+}
+
+func parseHead(b []byte) (head, error) {
+	if len(b) == 0 {
+		return head{}, io.ErrUnexpectedEOF
+	}
+	h := head{major: b[0] >> 5, info: b[0] & 0x1f, n: 1}
+	switch {
+	case h.info < 24:
+		h.arg = uint64(h.info)
+	case h.info <= 27:
+		size := 1 << (h.info - 24)
+		if len(b) < 1+size {
+			return head{}, io.ErrUnexpectedEOF
+		}
+		switch size {
+		case 1:
+			h.arg = uint64(b[1])
+		case 2:
+			h.arg = uint64(binary.BigEndian.Uint16(b[1:]))
+		case 4:
+			h.arg = uint64(binary.BigEndian.Uint32(b[1:]))
+		case 8:
+			h.arg = binary.BigEndian.Uint64(b[1:])
+		}
+		h.n += size
+	case h.info == 31:
+		return head{}, errIndefinite
+	default:
+		return head{}, fmt.Errorf("invalid additional information %d", h.info)
+	}
+	return h, nil
+}
+
+// reader implements item.SliceReader over an encoded item.
+type reader struct {
+	b   []byte
+	off int
+}
+
+func (r *reader) Len() int {
+	return len(r.b) - r.off
+}
+
+// head returns the head of the next item, skipping tags.
+func (r *reader) head() (head, error) {
+	for {
+		h, err := parseHead(r.b[r.off:])
+		if err != nil || h.major != majorTag {
+			return h, err
+		}
+		r.off += h.n
+	}
+}
+
+func (r *reader) expect(k item.Kind) (head, error) {
+	h, err := r.head()
+	if err != nil {
+		return h, err
+	}
+	if got := kind(h); got != k {
+		return h, fmt.Errorf("expected %s, found %s", k, got)
+	}
+	r.off += h.n
+	return h, nil
+}
+
+func kind(h head) item.Kind {
+	switch h.major {
+	case majorUint:
+		return item.Uint
+	case majorNegInt:
+		return item.Int
+	case majorBytes:
+		return item.Bytes
+	case majorText:
+		return item.String
+	case majorArray:
+		return item.Array
+	case majorMap:
+		return item.Map
+	case majorSimple:
+		switch h.info {
+		case simpleFalse, simpleTrue:
+			return item.Bool
+		case simpleNull, simpleUndef:
+			return item.Nil
+		case float16Info, float32Info, float64Info:
+			return item.Float
+		}
+	}
+	return item.Invalid
+}
+
+func (r *reader) Peek() (item.Kind, error) {
+	h, err := r.head()
+	if err != nil {
+		return item.Invalid, err
+	}
+	k := kind(h)
+	if k == item.Invalid {
+		return k, fmt.Errorf("unsupported simple value %d", h.arg)
+	}
+	return k, nil
+}
+
+func (r *reader) ReadNil() error {
+	_, err := r.expect(item.Nil)
+	return err
+}
+
+func (r *reader) ReadBool() (bool, error) {
+	h, err := r.expect(item.Bool)
+	return h.info == simpleTrue, err
+}
+
+func (r *reader) ReadInt() (int64, error) {
+	h, err := r.head()
+	if err != nil {
+		return 0, err
+	}
+	if h.major == majorUint {
+		u, err := r.ReadUint()
+		if err == nil && u > math.MaxInt64 {
+			err = fmt.Errorf("integer %d overflows int64", u)
+		}
+		return int64(u), err
+	}
+	if h, err = r.expect(item.Int); err != nil {
+		return 0, err
+	}
+	if h.arg > math.MaxInt64 {
+		return 0, fmt.Errorf("integer -1-%d overflows int64", h.arg)
+	}
+	return -1 - int64(h.arg), nil
+}
+
+func (r *reader) ReadUint() (uint64, error) {
+	h, err := r.expect(item.Uint)
+	return h.arg, err
+}
+
+func (r *reader) ReadFloat() (float64, error) {
+	h, err := r.expect(item.Float)
+	if err != nil {
+		return 0, err
+	}
+	switch h.info {
+	case float16Info:
+		return float16(uint16(h.arg)), nil
+	case float32Info:
+		return float64(math.Float32frombits(uint32(h.arg))), nil
+	}
+	return math.Float64frombits(h.arg), nil
+}
+
+func (r *reader) str(k item.Kind) ([]byte, error) {
+	h, err := r.expect(k)
+	if err != nil {
+		return nil, err
+	}
+	if h.arg > uint64(len(r.b)-r.off) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.b[r.off : r.off+int(h.arg)]
+	r.off += int(h.arg)
+	return b, nil
+}
+
+func (r *reader) ReadString() (string, error) {
+	b, err := r.str(item.String)
+	return string(b), err
+}
+
+func (r *reader) ReadBytes() ([]byte, error) {
+	return r.str(item.Bytes)
+}
+
+func (r *reader) container(k item.Kind, per uint64) (int, error) {
+	h, err := r.expect(k)
+	if err != nil {
+		return 0, err
+	}
+	// Every item takes at least one byte.
+	if h.arg > uint64(len(r.b)-r.off)/per {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(h.arg), nil
+}
+
+func (r *reader) ReadArrayHeader() (int, error) {
+	return r.container(item.Array, 1)
+}
+
+func (r *reader) ReadMapHeader() (int, error) {
+	return r.container(item.Map, 2)
+}
+
+func (r *reader) Skip() ([]byte, error) {
+	start := r.off
+	for pending := uint64(1); pending > 0; pending-- {
+		h, err := parseHead(r.b[r.off:])
+		if err != nil {
+			return nil, err
+		}
+		r.off += h.n
+		switch h.major {
+		case majorBytes, majorText:
+			if h.arg > uint64(len(r.b)-r.off) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			r.off += int(h.arg)
+		case majorArray, majorMap:
+			if h.arg > uint64(len(r.b)-r.off) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			pending += h.arg
+			if h.major == majorMap {
+				pending += h.arg
+			}
+		case majorTag:
+			pending++
+		}
+	}
+	return r.b[start:r.off], nil
+}
+
+// readItem appends the next item of r to buf.
+func readItem(r *bufio.Reader, buf []byte) ([]byte, error) {
+	for pending := uint64(1); pending > 0; pending-- {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf, err
+		}
+		start := len(buf)
+		buf = append(buf, c)
+		if info := c & 0x1f; info >= 24 && info <= 27 {
+			if buf, err = readN(r, buf, 1<<(info-24)); err != nil {
+				return buf, err
+			}
+		}
+		h, err := parseHead(buf[start:])
+		if err != nil {
+			return buf, fmt.Errorf("cbor: %w", err)
+		}
+		switch h.major {
+		case majorBytes, majorText:
+			if buf, err = readN(r, buf, h.arg); err != nil {
+				return buf, err
+			}
+		case majorArray, majorMap:
+			if h.arg > maxCount {
+				return buf, fmt.Errorf("cbor: container length %d too large", h.arg)
+			}
+			pending += h.arg
+			if h.major == majorMap {
+				pending += h.arg
+			}
+		case majorTag:
+			pending++
+		}
+	}
+	return buf, nil
+}
+
+// readN appends n bytes of r to buf, growing it as data arrives since n is
+// untrusted.
+func readN(r io.Reader, buf []byte, n uint64) ([]byte, error) {
+	const chunk = 32 << 10
+	for n > 0 {
+		m := n
+		if m > chunk {
+			m = chunk
+		}
+		start := len(buf)
+		buf = append(buf, make([]byte, m)...)
+		if _, err := io.ReadFull(r, buf[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf[:start], err
+		}
+		n -= m
+	}
+	return buf, nil
+}
+
+// float16 converts an IEEE 754 half-precision float.
+func float16(h uint16) float64 {
+	sign := 1.0
+	if h&0x8000 != 0 {
+		sign = -1
+	}
+	exp := int(h>>10) & 0x1f
+	frac := float64(h & 0x3ff)
+	switch exp {
+	case 0:
+		return sign * math.Ldexp(frac, -24)
+	case 0x1f:
+		if frac == 0 {
+			return math.Inf(int(sign))
+		}
+		return math.NaN()
+	}
+	return sign * math.Ldexp(frac+1024, exp-25)
+}
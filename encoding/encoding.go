@@ -0,0 +1,154 @@
+// Package encoding defines the Driver interface implemented by the
+// serialization formats, such as x/json, x/encoding/cbor and
+// x/encoding/msgpack, so they can be used interchangeably.
+//
+// All drivers honor the `json` struct tags, json.Raw and the
+// json.Marshaler/Unmarshaler implementations of the types they serialize, so
+// the same Go types can be used with every format.
+package encoding
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// ErrTooDeep and ErrTooLarge are returned by drivers decoding values nested
+// deeper or with strings longer than they allow.
+var (
+	ErrTooDeep  = errors.New("nested too deeply")
+	ErrTooLarge = errors.New("too large")
+)
+
+// jsonContentType is the media type of drivers that don't report one.
+const jsonContentType = "application/json"
+
+type Driver interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+
+	DecodeStream(r io.Reader, v interface{}) error
+	EncodeStream(w io.Writer, v interface{}) error
+}
+
+// StreamDriver is implemented by drivers that read successive values from a
+// single input stream themselves, see NewDecoder.
+type StreamDriver interface {
+	NewDecoder(r io.Reader) Decoder
+}
+
+// ContentTyper is implemented by drivers that report the media type of their
+// format, see ContentType.
+type ContentTyper interface {
+	// ContentType returns the media type of the format, e.g.
+	// "application/json".
+	ContentType() string
+}
+
+// Limits bound the values a driver decodes, see Limiter. Zero fields don't
+// limit anything.
+type Limits struct {
+	// MaxDepth is the maximum nesting depth of arrays and maps.
+	MaxDepth int
+	// MaxStringLength is the maximum length in bytes of strings and map keys, as
+	// encoded.
+	MaxStringLength int
+}
+
+// Limiter is implemented by drivers that can bound the values they decode.
+type Limiter interface {
+	// Limit returns a driver decoding like this one, but failing with
+	// ErrTooDeep or ErrTooLarge for values exceeding l.
+	Limit(l Limits) Driver
+}
+
+// Decoder reads successive values from a single input stream.
+type Decoder interface {
+	Decode(v interface{}) error
+	// More reports whether there is another element in the current array or
+	// object being parsed.
+	More() bool
+	// InputOffset returns the input stream byte offset of the current decoder
+	// position.
+	InputOffset() int64
+}
+
+// ContentType returns the media type of d. Drivers that don't implement
+// ContentTyper are taken to be JSON drivers.
+func ContentType(d Driver) string {
+	if ct, ok := d.(ContentTyper); ok {
+		return ct.ContentType()
+	}
+	return jsonContentType
+}
+
+// NewDecoder returns a Decoder reading the values of d from r. For drivers that
+// don't implement StreamDriver, JSON values are split with encoding/json and
+// decoded with the Unmarshal method of d, values of other formats are read with
+// its DecodeStream method.
+func NewDecoder(d Driver, r io.Reader) Decoder {
+	if sd, ok := d.(StreamDriver); ok {
+		return sd.NewDecoder(r)
+	}
+	if ContentType(d) == jsonContentType {
+		return &jsonDecoder{d: d, dec: json.NewDecoder(r)}
+	}
+	cr := &countingReader{r: r}
+	return &streamDecoder{d: d, cr: cr, r: bufio.NewReader(cr)}
+}
+
+// jsonDecoder decodes the JSON values split by dec with d.
+type jsonDecoder struct {
+	d   Driver
+	dec *json.Decoder
+	raw json.RawMessage
+}
+
+func (dec *jsonDecoder) Decode(v interface{}) error {
+	dec.raw = dec.raw[:0]
+	if err := dec.dec.Decode(&dec.raw); err != nil {
+		return err
+	}
+	return dec.d.Unmarshal(dec.raw, v)
+}
+
+func (dec *jsonDecoder) More() bool {
+	return dec.dec.More()
+}
+
+func (dec *jsonDecoder) InputOffset() int64 {
+	return dec.dec.InputOffset()
+}
+
+// streamDecoder decodes values from r with the DecodeStream method of d. Its
+// offset is exact as long as d doesn't read ahead of the values.
+type streamDecoder struct {
+	d  Driver
+	cr *countingReader
+	r  *bufio.Reader
+}
+
+func (dec *streamDecoder) Decode(v interface{}) error {
+	return dec.d.DecodeStream(dec.r, v)
+}
+
+func (dec *streamDecoder) More() bool {
+	_, err := dec.r.Peek(1)
+	return err == nil
+}
+
+func (dec *streamDecoder) InputOffset() int64 {
+	return dec.cr.n - int64(dec.r.Buffered())
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
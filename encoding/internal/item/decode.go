@@ -0,0 +1,590 @@
+package item
+
+import (
+	"encoding"
+	stdjson "encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+
+	xencoding "x/encoding"
+	"x/json"
+)
+
+// UnmarshalTypeError describes an item that was not appropriate for the Go
+// value it was decoded into.
+type UnmarshalTypeError struct {
+	Kind Kind
+	Type reflect.Type
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "cannot unmarshal " + e.Kind.String() + " into Go value of type " + e.Type.String()
+}
+
+// DefaultMaxDepth is the nesting depth of arrays and maps Unmarshal allows, the
+// same as encoding/json.
+const DefaultMaxDepth = 10000
+
+// Unmarshal reads the next item of r into v, which must be a non-nil pointer.
+// Items nested deeper than DefaultMaxDepth fail with xencoding.ErrTooDeep.
+func Unmarshal(r Reader, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("Unmarshal(non-pointer or nil %T)", v)
+	}
+	d := decoder{r: r, maxDepth: DefaultMaxDepth}
+	return d.decode(rv.Elem(), false)
+}
+
+// Check reads the next item of r, failing with xencoding.ErrTooDeep or
+// xencoding.ErrTooLarge if it exceeds l. It does not validate the item
+// otherwise. MaxDepth is at most DefaultMaxDepth.
+func Check(r Reader, l xencoding.Limits) error {
+	d := decoder{r: r, maxDepth: DefaultMaxDepth}
+	if l.MaxDepth > 0 && l.MaxDepth < d.maxDepth {
+		d.maxDepth = l.MaxDepth
+	}
+	return d.check(l.MaxStringLength)
+}
+
+// decoder reads items from r, keeping track of their nesting depth.
+type decoder struct {
+	r        Reader
+	depth    int
+	maxDepth int
+}
+
+// enter is called before reading the elements of an array or map, leave after.
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > d.maxDepth {
+		return fmt.Errorf("%w: more than %d levels", xencoding.ErrTooDeep, d.maxDepth)
+	}
+	return nil
+}
+
+func (d *decoder) leave() {
+	d.depth--
+}
+
+func (d *decoder) decode(v reflect.Value, quoted bool) error {
+	t := v.Type()
+	if t == rawType {
+		b, err := d.r.Skip()
+		if err != nil {
+			return err
+		}
+		v.SetBytes(append(v.Bytes()[:0], b...))
+		return nil
+	}
+
+	k, err := d.r.Peek()
+	if err != nil {
+		return err
+	}
+	if k == Nil {
+		if err := d.r.ReadNil(); err != nil {
+			return err
+		}
+		switch v.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(t))
+			return nil
+		}
+		if u, ok := implements(v, unmarshalerType); ok {
+			return u.Interface().(json.Unmarshaler).UnmarshalJSON([]byte("null"))
+		}
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return d.decode(v.Elem(), quoted)
+	}
+	if u, ok := implements(v, unmarshalerType); ok {
+		x, err := d.readAny()
+		if err != nil {
+			return err
+		}
+		b, err := stdjson.Marshal(x)
+		if err != nil {
+			return err
+		}
+		return u.Interface().(json.Unmarshaler).UnmarshalJSON(b)
+	}
+	if k == String {
+		if u, ok := implements(v, textUnmarshalerType); ok {
+			s, err := d.r.ReadString()
+			if err != nil {
+				return err
+			}
+			return u.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+		if quoted {
+			s, err := d.r.ReadString()
+			if err != nil {
+				return err
+			}
+			return setQuoted(v, s)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			return &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		x, err := d.readAny()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(x))
+	case reflect.Bool:
+		if k != Bool {
+			return &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		b, err := d.r.ReadBool()
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := readInt(d.r, k, t)
+		if err != nil {
+			return err
+		}
+		if v.OverflowInt(i) {
+			return &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := readUint(d.r, k, t)
+		if err != nil {
+			return err
+		}
+		if v.OverflowUint(u) {
+			return &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := readFloat(d.r, k, t)
+		if err != nil {
+			return err
+		}
+		if v.OverflowFloat(f) {
+			return &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		v.SetFloat(f)
+	case reflect.String:
+		if k != String {
+			return &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		s, err := d.r.ReadString()
+		if err != nil {
+			return err
+		}
+		v.SetString(s)
+	case reflect.Slice:
+		if k == Bytes && t.Elem().Kind() == reflect.Uint8 {
+			b, err := d.r.ReadBytes()
+			if err != nil {
+				return err
+			}
+			v.SetBytes(append(v.Bytes()[:0], b...))
+			return nil
+		}
+		return d.decodeSlice(v, k)
+	case reflect.Array:
+		return d.decodeArray(v, k)
+	case reflect.Map:
+		return d.decodeMap(v, k)
+	case reflect.Struct:
+		return d.decodeStruct(v, k)
+	default:
+		return &UnmarshalTypeError{Kind: k, Type: t}
+	}
+	return nil
+}
+
+func (d *decoder) decodeSlice(v reflect.Value, k Kind) error {
+	if k != Array {
+		return &UnmarshalTypeError{Kind: k, Type: v.Type()}
+	}
+	n, err := d.r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	// The header is untrusted, grow as elements are read.
+	s := reflect.MakeSlice(v.Type(), 0, minInt(n, 64))
+	zero := reflect.Zero(v.Type().Elem())
+	for i := 0; i < n; i++ {
+		s = reflect.Append(s, zero)
+		if err := d.decode(s.Index(i), false); err != nil {
+			return err
+		}
+	}
+	v.Set(s)
+	return nil
+}
+
+func (d *decoder) decodeArray(v reflect.Value, k Kind) error {
+	if k != Array {
+		return &UnmarshalTypeError{Kind: k, Type: v.Type()}
+	}
+	n, err := d.r.ReadArrayHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	for i := 0; i < n; i++ {
+		if i >= v.Len() {
+			if _, err := d.r.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := d.decode(v.Index(i), false); err != nil {
+			return err
+		}
+	}
+	for i := n; i < v.Len(); i++ {
+		v.Index(i).Set(reflect.Zero(v.Type().Elem()))
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(v reflect.Value, k Kind) error {
+	t := v.Type()
+	if k != Map {
+		return &UnmarshalTypeError{Kind: k, Type: t}
+	}
+	n, err := d.r.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(t))
+	}
+	for i := 0; i < n; i++ {
+		key := reflect.New(t.Key()).Elem()
+		if err := d.decodeKey(key); err != nil {
+			return err
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if err := d.decode(elem, false); err != nil {
+			return err
+		}
+		v.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+func (d *decoder) decodeKey(v reflect.Value) error {
+	k, err := d.r.Peek()
+	if err != nil {
+		return err
+	}
+	if k == String {
+		s, err := d.r.ReadString()
+		if err != nil {
+			return err
+		}
+		if u, ok := implements(v, textUnmarshalerType); ok && v.Kind() != reflect.String {
+			return u.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}
+		if v.Kind() == reflect.String {
+			v.SetString(s)
+			return nil
+		}
+		return setQuoted(v, s)
+	}
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if k == Int || k == Uint {
+			return d.decode(v, false)
+		}
+	}
+	return &UnmarshalTypeError{Kind: k, Type: v.Type()}
+}
+
+func (d *decoder) decodeStruct(v reflect.Value, k Kind) error {
+	if k != Map {
+		return &UnmarshalTypeError{Kind: k, Type: v.Type()}
+	}
+	n, err := d.r.ReadMapHeader()
+	if err != nil {
+		return err
+	}
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer d.leave()
+	fields := cachedFields(v.Type())
+	for i := 0; i < n; i++ {
+		var f *field
+		if k, err := d.r.Peek(); err != nil {
+			return err
+		} else if k == String {
+			key, err := d.r.ReadString()
+			if err != nil {
+				return err
+			}
+			f = lookupField(fields, key)
+		} else if _, err := d.r.Skip(); err != nil {
+			return err
+		}
+
+		if f == nil {
+			if _, err := d.r.Skip(); err != nil {
+				return err
+			}
+			continue
+		}
+		fv, ok := fieldByIndex(v, f.index, true)
+		if !ok {
+			return fmt.Errorf("cannot set embedded pointer to unexported struct: %s", v.Type())
+		}
+		if err := d.decode(fv, f.quoted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readInt(r Reader, k Kind, t reflect.Type) (int64, error) {
+	switch k {
+	case Int:
+		return r.ReadInt()
+	case Uint:
+		u, err := r.ReadUint()
+		if err == nil && u > math.MaxInt64 {
+			err = &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		return int64(u), err
+	case Float:
+		f, err := r.ReadFloat()
+		if err == nil && (f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64) {
+			err = &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		return int64(f), err
+	}
+	return 0, &UnmarshalTypeError{Kind: k, Type: t}
+}
+
+func readUint(r Reader, k Kind, t reflect.Type) (uint64, error) {
+	switch k {
+	case Uint:
+		return r.ReadUint()
+	case Float:
+		f, err := r.ReadFloat()
+		if err == nil && (f != math.Trunc(f) || f < 0 || f >= math.MaxUint64) {
+			err = &UnmarshalTypeError{Kind: k, Type: t}
+		}
+		return uint64(f), err
+	}
+	return 0, &UnmarshalTypeError{Kind: k, Type: t}
+}
+
+func readFloat(r Reader, k Kind, t reflect.Type) (float64, error) {
+	switch k {
+	case Int:
+		i, err := r.ReadInt()
+		return float64(i), err
+	case Uint:
+		u, err := r.ReadUint()
+		return float64(u), err
+	case Float:
+		return r.ReadFloat()
+	}
+	return 0, &UnmarshalTypeError{Kind: k, Type: t}
+}
+
+// setQuoted sets a number or boolean from its string form.
+func setQuoted(v reflect.Value, s string) error {
+	var err error
+	switch v.Kind() {
+	case reflect.Bool:
+		var b bool
+		if b, err = strconv.ParseBool(s); err == nil {
+			v.SetBool(b)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if i, err = strconv.ParseInt(s, 10, v.Type().Bits()); err == nil {
+			v.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var u uint64
+		if u, err = strconv.ParseUint(s, 10, v.Type().Bits()); err == nil {
+			v.SetUint(u)
+		}
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		if f, err = strconv.ParseFloat(s, v.Type().Bits()); err == nil {
+			v.SetFloat(f)
+		}
+	default:
+		return &UnmarshalTypeError{Kind: String, Type: v.Type()}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for type %s: %w", s, v.Type(), errors.Unwrap(err))
+	}
+	return nil
+}
+
+// readAny reads the next item as nil, bool, int64, uint64 (for integers
+// above math.MaxInt64), float64, string, []byte, []interface{} or
+// map[string]interface{}.
+func (d *decoder) readAny() (interface{}, error) {
+	k, err := d.r.Peek()
+	if err != nil {
+		return nil, err
+	}
+	switch k {
+	case Nil:
+		return nil, d.r.ReadNil()
+	case Bool:
+		return d.r.ReadBool()
+	case Int:
+		return d.r.ReadInt()
+	case Uint:
+		u, err := d.r.ReadUint()
+		if u <= math.MaxInt64 {
+			return int64(u), err
+		}
+		return u, err
+	case Float:
+		return d.r.ReadFloat()
+	case String:
+		return d.r.ReadString()
+	case Bytes:
+		b, err := d.r.ReadBytes()
+		return append([]byte(nil), b...), err
+	case Array:
+		n, err := d.r.ReadArrayHeader()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		a := make([]interface{}, 0, minInt(n, 64))
+		for i := 0; i < n; i++ {
+			x, err := d.readAny()
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, x)
+		}
+		return a, nil
+	case Map:
+		n, err := d.r.ReadMapHeader()
+		if err != nil {
+			return nil, err
+		}
+		if err := d.enter(); err != nil {
+			return nil, err
+		}
+		defer d.leave()
+		m := make(map[string]interface{}, minInt(n, 64))
+		for i := 0; i < n; i++ {
+			key, err := d.readAny()
+			if err != nil {
+				return nil, err
+			}
+			x, err := d.readAny()
+			if err != nil {
+				return nil, err
+			}
+			switch key := key.(type) {
+			case string:
+				m[key] = x
+			default:
+				m[fmt.Sprint(key)] = x
+			}
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported item kind: %s", k)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// check reads the next item, failing for strings and byte strings longer than
+// maxString bytes, if positive, or for arrays and maps nested too deeply.
+func (d *decoder) check(maxString int) error {
+	k, err := d.r.Peek()
+	if err != nil {
+		// Unsupported scalars, such as extension types, may still be skipped.
+		_, err = d.r.Skip()
+		return err
+	}
+	switch k {
+	case String, Bytes:
+		var n int
+		if k == String {
+			s, err := d.r.ReadString()
+			if err != nil {
+				return err
+			}
+			n = len(s)
+		} else {
+			b, err := d.r.ReadBytes()
+			if err != nil {
+				return err
+			}
+			n = len(b)
+		}
+		if maxString > 0 && n > maxString {
+			return fmt.Errorf("%w: string longer than %d bytes", xencoding.ErrTooLarge, maxString)
+		}
+		return nil
+	case Array, Map:
+		var n int
+		if k == Array {
+			n, err = d.r.ReadArrayHeader()
+		} else {
+			n, err = d.r.ReadMapHeader()
+			n *= 2
+		}
+		if err != nil {
+			return err
+		}
+		if err := d.enter(); err != nil {
+			return err
+		}
+		defer d.leave()
+		for i := 0; i < n; i++ {
+			if err := d.check(maxString); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	_, err = d.r.Skip()
+	return err
+}
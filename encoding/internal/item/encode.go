@@ -0,0 +1,306 @@
+package item
+
+import (
+	"bytes"
+	"encoding"
+	stdjson "encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+
+	"x/json"
+)
+
+var (
+	rawType             = reflect.TypeOf(json.Raw(nil))
+	marshalerType       = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// Marshal writes v to w.
+func Marshal(w Writer, v interface{}) error {
+	return encode(w, reflect.ValueOf(v), false)
+}
+
+func encode(w Writer, v reflect.Value, quoted bool) error {
+	if !v.IsValid() {
+		w.WriteNil()
+		return nil
+	}
+	t := v.Type()
+	if t == rawType {
+		if v.IsNil() {
+			w.WriteNil()
+		} else {
+			w.WriteRaw(v.Bytes())
+		}
+		return nil
+	}
+	if (t.Kind() == reflect.Pointer || t.Kind() == reflect.Interface) && v.IsNil() {
+		w.WriteNil()
+		return nil
+	}
+
+	if m, ok := implements(v, marshalerType); ok {
+		b, err := m.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return fmt.Errorf("error calling MarshalJSON for type %s: %w", t, err)
+		}
+		return transcode(w, b)
+	}
+	if m, ok := implements(v, textMarshalerType); ok {
+		b, err := m.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return fmt.Errorf("error calling MarshalText for type %s: %w", t, err)
+		}
+		w.WriteString(string(b))
+		return nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if quoted {
+			w.WriteString(strconv.FormatBool(v.Bool()))
+		} else {
+			w.WriteBool(v.Bool())
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if quoted {
+			w.WriteString(strconv.FormatInt(v.Int(), 10))
+		} else {
+			w.WriteInt(v.Int())
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if quoted {
+			w.WriteString(strconv.FormatUint(v.Uint(), 10))
+		} else {
+			w.WriteUint(v.Uint())
+		}
+	case reflect.Float32:
+		if quoted {
+			w.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 32))
+		} else {
+			w.WriteFloat32(float32(v.Float()))
+		}
+	case reflect.Float64:
+		if quoted {
+			w.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, 64))
+		} else {
+			w.WriteFloat64(v.Float())
+		}
+	case reflect.String:
+		w.WriteString(v.String())
+	case reflect.Interface, reflect.Pointer:
+		return encode(w, v.Elem(), quoted)
+	case reflect.Slice:
+		if v.IsNil() {
+			w.WriteNil()
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			w.WriteBytes(v.Bytes())
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		w.WriteArrayHeader(v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := encode(w, v.Index(i), false); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			w.WriteNil()
+			return nil
+		}
+		return encodeMap(w, v)
+	case reflect.Struct:
+		return encodeStruct(w, v)
+	default:
+		return fmt.Errorf("unsupported type: %s", t)
+	}
+	return nil
+}
+
+type mapKey struct {
+	s string
+	k reflect.Value
+}
+
+func encodeMap(w Writer, v reflect.Value) error {
+	keys := make([]mapKey, 0, v.Len())
+	for it := v.MapRange(); it.Next(); {
+		k := it.Key()
+		var s string
+		if m, ok := implements(k, textMarshalerType); ok && k.Kind() != reflect.String {
+			if k.Kind() == reflect.Pointer && k.IsNil() {
+				continue
+			}
+			b, err := m.Interface().(encoding.TextMarshaler).MarshalText()
+			if err != nil {
+				return fmt.Errorf("error calling MarshalText for type %s: %w", k.Type(), err)
+			}
+			s = string(b)
+		} else {
+			switch k.Kind() {
+			case reflect.String:
+				s = k.String()
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				s = strconv.FormatInt(k.Int(), 10)
+			case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+				s = strconv.FormatUint(k.Uint(), 10)
+			default:
+				return fmt.Errorf("unsupported map key type: %s", k.Type())
+			}
+		}
+		keys = append(keys, mapKey{s: s, k: k})
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].s < keys[j].s })
+
+	w.WriteMapHeader(len(keys))
+	for _, k := range keys {
+		switch k.k.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			w.WriteInt(k.k.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			w.WriteUint(k.k.Uint())
+		default:
+			w.WriteString(k.s)
+		}
+		if err := encode(w, v.MapIndex(k.k), false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func encodeStruct(w Writer, v reflect.Value) error {
+	fields := cachedFields(v.Type())
+	var scratch [16]reflect.Value
+	values := scratch[:0]
+	n := 0
+	for i := range fields {
+		fv, ok := fieldByIndex(v, fields[i].index, false)
+		if ok && fields[i].omitEmpty && isEmptyValue(fv) {
+			ok = false
+		}
+		if !ok {
+			fv = reflect.Value{}
+		} else {
+			n++
+		}
+		values = append(values, fv)
+	}
+
+	w.WriteMapHeader(n)
+	for i, fv := range values {
+		if !fv.IsValid() {
+			continue
+		}
+		w.WriteString(fields[i].name)
+		if err := encode(w, fv, fields[i].quoted); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldByIndex returns the nested field of v. Nil embedded pointers are
+// allocated if alloc is set, otherwise the field is reported as missing.
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// implements returns v, or its address, if it implements the interface i.
+func implements(v reflect.Value, i reflect.Type) (reflect.Value, bool) {
+	if v.Type().Implements(i) {
+		return v, true
+	}
+	if v.Kind() != reflect.Pointer && v.CanAddr() && reflect.PointerTo(v.Type()).Implements(i) {
+		return v.Addr(), true
+	}
+	return reflect.Value{}, false
+}
+
+// transcode writes the JSON encoding b as items.
+func transcode(w Writer, b []byte) error {
+	dec := stdjson.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var x interface{}
+	if err := dec.Decode(&x); err != nil {
+		return err
+	}
+	writeAny(w, x)
+	return nil
+}
+
+// writeAny writes a value decoded by encoding/json.
+func writeAny(w Writer, x interface{}) {
+	switch x := x.(type) {
+	case nil:
+		w.WriteNil()
+	case bool:
+		w.WriteBool(x)
+	case string:
+		w.WriteString(x)
+	case stdjson.Number:
+		if i, err := x.Int64(); err == nil {
+			w.WriteInt(i)
+		} else if u, err := strconv.ParseUint(string(x), 10, 64); err == nil {
+			w.WriteUint(u)
+		} else {
+			f, _ := x.Float64()
+			w.WriteFloat64(f)
+		}
+	case []interface{}:
+		w.WriteArrayHeader(len(x))
+		for _, e := range x {
+			writeAny(w, e)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(x))
+		for k := range x {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		w.WriteMapHeader(len(keys))
+		for _, k := range keys {
+			w.WriteString(k)
+			writeAny(w, x[k])
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package item
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// field is a serialized struct field, following the encoding/json rules for
+// `json` tags and embedded structs.
+type field struct {
+	name      string
+	index     []int
+	tagged    bool
+	omitEmpty bool
+	// quoted is set by the ",string" option of numbers and booleans.
+	quoted bool
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+func cachedFields(t reflect.Type) []field {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]field)
+	}
+	f, _ := fieldCache.LoadOrStore(t, typeFields(t))
+	return f.([]field)
+}
+
+func typeFields(t reflect.Type) []field {
+	type embedded struct {
+		t     reflect.Type
+		index []int
+	}
+
+	var fields []field
+	visited := map[reflect.Type]bool{}
+	for next := []embedded{{t: t}}; len(next) > 0; {
+		current := next
+		next = nil
+		for _, e := range current {
+			if visited[e.t] {
+				continue
+			}
+			visited[e.t] = true
+
+			for i := 0; i < e.t.NumField(); i++ {
+				sf := e.t.Field(i)
+				ft := sf.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if sf.Anonymous {
+					if !sf.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !sf.IsExported() {
+					continue
+				}
+
+				tag := sf.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name, opts, _ := strings.Cut(tag, ",")
+				index := make([]int, len(e.index)+1)
+				copy(index, e.index)
+				index[len(e.index)] = i
+
+				if name == "" && sf.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedded{t: ft, index: index})
+					continue
+				}
+
+				f := field{name: name, index: index, tagged: name != ""}
+				if name == "" {
+					f.name = sf.Name
+				}
+				for opts != "" {
+					var opt string
+					opt, opts, _ = strings.Cut(opts, ",")
+					switch opt {
+					case "omitempty":
+						f.omitEmpty = true
+					case "string":
+						switch ft.Kind() {
+						case reflect.Bool,
+							reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+							reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+							reflect.Float32, reflect.Float64:
+							f.quoted = true
+						}
+					}
+				}
+				fields = append(fields, f)
+			}
+		}
+	}
+
+	// Among fields with the same name, the shallowest wins; at the same depth a
+	// tagged field wins, otherwise all of them are dropped.
+	sort.SliceStable(fields, func(i, j int) bool {
+		a, b := fields[i], fields[j]
+		if a.name != b.name {
+			return a.name < b.name
+		}
+		if len(a.index) != len(b.index) {
+			return len(a.index) < len(b.index)
+		}
+		return a.tagged && !b.tagged
+	})
+	out := fields[:0]
+	for i := 0; i < len(fields); {
+		j := i + 1
+		for j < len(fields) && fields[j].name == fields[i].name {
+			j++
+		}
+		if j-i == 1 || len(fields[i].index) < len(fields[i+1].index) || fields[i].tagged && !fields[i+1].tagged {
+			out = append(out, fields[i])
+		}
+		i = j
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i].index, out[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return out
+}
+
+// lookupField finds the field for a map key, preferring an exact match over a
+// case-insensitive one.
+func lookupField(fields []field, key string) *field {
+	var fold *field
+	for i := range fields {
+		if fields[i].name == key {
+			return &fields[i]
+		}
+		if fold == nil && strings.EqualFold(fields[i].name, key) {
+			fold = &fields[i]
+		}
+	}
+	return fold
+}
@@ -0,0 +1,113 @@
+package item
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	xencoding "x/encoding"
+)
+
+// Format is a binary format of items. Its methods implement the parts of
+// xencoding.Driver the formats share.
+type Format struct {
+	// Name prefixes the errors of the format, e.g. "cbor".
+	Name string
+	// ErrTrailingData is returned for data holding more than one item.
+	ErrTrailingData error
+	// NewReader returns a SliceReader of data.
+	NewReader func(data []byte) SliceReader
+	// NewWriter returns an empty SliceWriter.
+	NewWriter func() SliceWriter
+	// ReadItem appends the next item of r to buf. It returns io.EOF if r ends
+	// before the item starts.
+	ReadItem func(r *bufio.Reader, buf []byte) ([]byte, error)
+}
+
+// SliceReader is a Reader of items held in memory.
+type SliceReader interface {
+	Reader
+	// Len returns the number of bytes not read yet.
+	Len() int
+}
+
+// SliceWriter is a Writer of items to memory.
+type SliceWriter interface {
+	Writer
+	// Bytes returns the items written.
+	Bytes() []byte
+}
+
+// Marshal returns the encoding of v.
+func (f *Format) Marshal(v interface{}) ([]byte, error) {
+	w := f.NewWriter()
+	if err := Marshal(w, v); err != nil {
+		return nil, fmt.Errorf("%s: %w", f.Name, err)
+	}
+	return w.Bytes(), nil
+}
+
+// EncodeStream writes the encoding of v to w.
+func (f *Format) EncodeStream(w io.Writer, v interface{}) error {
+	b, err := f.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Unmarshal decodes the item data into v, checking it against l first if set.
+func (f *Format) Unmarshal(data []byte, v interface{}, l xencoding.Limits) error {
+	if l != (xencoding.Limits{}) {
+		if err := Check(f.NewReader(data), l); err != nil {
+			return fmt.Errorf("%s: %w", f.Name, err)
+		}
+	}
+	r := f.NewReader(data)
+	if err := Unmarshal(r, v); err != nil {
+		return fmt.Errorf("%s: %w", f.Name, err)
+	}
+	if r.Len() != 0 {
+		return f.ErrTrailingData
+	}
+	return nil
+}
+
+// NewDecoder returns a Decoder of the items of r, which it checks against l
+// like Unmarshal.
+func (f *Format) NewDecoder(r io.Reader, l xencoding.Limits) *Decoder {
+	return &Decoder{f: f, r: bufio.NewReader(r), limits: l}
+}
+
+// Decoder reads successive items from an input stream.
+type Decoder struct {
+	f      *Format
+	r      *bufio.Reader
+	buf    []byte
+	off    int64
+	limits xencoding.Limits
+}
+
+// Decode reads the next item into v. It returns io.EOF if the stream ends
+// before the item starts.
+func (d *Decoder) Decode(v interface{}) error {
+	b, err := d.f.ReadItem(d.r, d.buf[:0])
+	d.buf = b
+	if err != nil {
+		return err
+	}
+	d.off += int64(len(b))
+	return d.f.Unmarshal(b, v, d.limits)
+}
+
+// More reports whether there is another item in the stream.
+func (d *Decoder) More() bool {
+	_, err := d.r.Peek(1)
+	return err == nil
+}
+
+// InputOffset returns the offset of the end of the last decoded item.
+func (d *Decoder) InputOffset() int64 {
+	return d.off
+}
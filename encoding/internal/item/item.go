@@ -0,0 +1,85 @@
+// Package item maps Go values to and from the data model shared by the
+// binary formats (CBOR, MessagePack): nil, booleans, integers, floats, text
+// and byte strings, arrays and maps.
+//
+// The mapping follows encoding/json: `json` struct tags, json.Raw,
+// json.Marshaler/Unmarshaler and encoding.TextMarshaler/TextUnmarshaler are
+// honored, so the same Go types serialize to every format. Values that
+// implement json.Marshaler are transcoded from their JSON representation.
+package item
+
+import "fmt"
+
+// Kind is the kind of the next item of a Reader.
+type Kind uint8
+
+const (
+	Invalid Kind = iota
+	Nil
+	Bool
+	// Int is a negative integer.
+	Int
+	// Uint is a non-negative integer.
+	Uint
+	Float
+	String
+	Bytes
+	Array
+	Map
+)
+
+var kindNames = [...]string{
+	Invalid: "invalid",
+	Nil:     "nil",
+	Bool:    "bool",
+	Int:     "integer",
+	Uint:    "integer",
+	Float:   "float",
+	String:  "string",
+	Bytes:   "bytes",
+	Array:   "array",
+	Map:     "map",
+}
+
+func (k Kind) String() string {
+	if int(k) < len(kindNames) {
+		return kindNames[k]
+	}
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// Writer appends encoded items.
+type Writer interface {
+	WriteNil()
+	WriteBool(b bool)
+	WriteInt(i int64)
+	WriteUint(u uint64)
+	WriteFloat32(f float32)
+	WriteFloat64(f float64)
+	WriteString(s string)
+	WriteBytes(b []byte)
+	WriteArrayHeader(n int)
+	WriteMapHeader(n int)
+	// WriteRaw appends an already encoded item.
+	WriteRaw(b []byte)
+}
+
+// Reader reads encoded items. The Read methods fail if the next item is not
+// of the expected Kind.
+type Reader interface {
+	// Peek returns the Kind of the next item without consuming it.
+	Peek() (Kind, error)
+	ReadNil() error
+	ReadBool() (bool, error)
+	ReadInt() (int64, error)
+	ReadUint() (uint64, error)
+	ReadFloat() (float64, error)
+	ReadString() (string, error)
+	// ReadBytes returns a byte string. The result may alias the input.
+	ReadBytes() ([]byte, error)
+	ReadArrayHeader() (int, error)
+	ReadMapHeader() (int, error)
+	// Skip consumes the next item and returns its encoding. The result may
+	// alias the input.
+	Skip() ([]byte, error)
+}
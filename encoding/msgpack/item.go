@@ -0,0 +1,455 @@
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"x/encoding/internal/item"
+)
+
+const (
+	codeNil     = 0xc0
+	codeFalse   = 0xc2
+	codeTrue    = 0xc3
+	codeBin8    = 0xc4
+	codeBin16   = 0xc5
+	codeBin32   = 0xc6
+	codeExt8    = 0xc7
+	codeExt16   = 0xc8
+	codeExt32   = 0xc9
+	codeFloat32 = 0xca
+	codeFloat64 = 0xcb
+	codeUint8   = 0xcc
+	codeUint16  = 0xcd
+	codeUint32  = 0xce
+	codeUint64  = 0xcf
+	codeInt8    = 0xd0
+	codeInt16   = 0xd1
+	codeInt32   = 0xd2
+	codeInt64   = 0xd3
+	codeFixExt1 = 0xd4
+	codeFixExt  = 0xd8
+	codeStr8    = 0xd9
+	codeStr16   = 0xda
+	codeStr32   = 0xdb
+	codeArray16 = 0xdc
+	codeArray32 = 0xdd
+	codeMap16   = 0xde
+	codeMap32   = 0xdf
+)
+
+// writer implements item.SliceWriter.
+type writer struct {
+	b []byte
+}
+
+func (w *writer) Bytes() []byte {
+	return w.b
+}
+
+func (w *writer) sized(c8, c16, c32 byte, n int) {
+	switch {
+	case c8 != 0 && n <= math.MaxUint8:
+		w.b = append(w.b, c8, byte(n))
+	case n <= math.MaxUint16:
+		w.b = binary.BigEndian.AppendUint16(append(w.b, c16), uint16(n))
+	default:
+		w.b = binary.BigEndian.AppendUint32(append(w.b, c32), uint32(n))
+	}
+}
+
+func (w *writer) WriteNil() {
+	w.b = append(w.b, codeNil)
+}
+
+func (w *writer) WriteBool(b bool) {
+	if b {
+		w.b = append(w.b, codeTrue)
+	} else {
+		w.b = append(w.b, codeFalse)
+	}
+}
+
+func (w *writer) WriteInt(i int64) {
+	switch {
+	case i >= 0:
+		w.WriteUint(uint64(i))
+	case i >= -32:
+		w.b = append(w.b, byte(i))
+	case i >= math.MinInt8:
+		w.b = append(w.b, codeInt8, byte(i))
+	case i >= math.MinInt16:
+		w.b = binary.BigEndian.AppendUint16(append(w.b, codeInt16), uint16(i))
+	case i >= math.MinInt32:
+		w.b = binary.BigEndian.AppendUint32(append(w.b, codeInt32), uint32(i))
+	default:
+		w.b = binary.BigEndian.AppendUint64(append(w.b, codeInt64), uint64(i))
+	}
+}
+
+func (w *writer) WriteUint(u uint64) {
+	switch {
+	case u <= math.MaxInt8:
+		w.b = append(w.b, byte(u))
+	case u <= math.MaxUint8:
+		w.b = append(w.b, codeUint8, byte(u))
+	case u <= math.MaxUint16:
+		w.b = binary.BigEndian.AppendUint16(append(w.b, codeUint16), uint16(u))
+	case u <= math.MaxUint32:
+		w.b = binary.BigEndian.AppendUint32(append(w.b, codeUint32), uint32(u))
+	default:
+		w.b = binary.BigEndian.AppendUint64(append(w.b, codeUint64), u)
+	}
+}
+
+func (w *writer) WriteFloat32(f float32) {
+	w.b = binary.BigEndian.AppendUint32(append(w.b, codeFloat32), math.Float32bits(f))
+}
+
+func (w *writer) WriteFloat64(f float64) {
+	w.b = binary.BigEndian.AppendUint64(append(w.b, codeFloat64), math.Float64bits(f))
+}
+
+func (w *writer) WriteString(s string) {
+	if len(s) < 32 {
+		w.b = append(w.b, 0xa0|byte(len(s)))
+	} else {
+		w.sized(codeStr8, codeStr16, codeStr32, len(s))
+	}
+	w.b = append(w.b, s...)
+}
+
+func (w *writer) WriteBytes(b []byte) {
+	w.sized(codeBin8, codeBin16, codeBin32, len(b))
+	w.b = append(w.b, b...)
+}
+
+func (w *writer) WriteArrayHeader(n int) {
+	if n < 16 {
+		w.b = append(w.b, 0x90|byte(n))
+	} else {
+		w.sized(0, codeArray16, codeArray32, n)
+	}
+}
+
+func (w *writer) WriteMapHeader(n int) {
+	if n < 16 {
+		w.b = append(w.b, 0x80|byte(n))
+	} else {
+		w.sized(0, codeMap16, codeMap32, n)
+	}
+}
+
+func (w *writer) WriteRaw(b []byte) {
+	w.b = append(w.b, b...)
+}
+
+// headSize returns the size of the head starting with c: the type code, any
+// length and extension type, and the value of numbers.
+func headSize(c byte) int {
+	switch c {
+	case codeBin8, codeStr8, codeUint8, codeInt8:
+		return 2
+	case codeBin16, codeStr16, codeArray16, codeMap16, codeUint16, codeInt16, codeExt8:
+		return 3
+	case codeExt16:
+		return 4
+	case codeBin32, codeStr32, codeArray32, codeMap32, codeUint32, codeInt32, codeFloat32:
+		return 5
+	case codeExt32:
+		return 6
+	case codeUint64, codeInt64, codeFloat64:
+		return 9
+	}
+	if c >= codeFixExt1 && c <= codeFixExt {
+		return 2
+	}
+	return 1
+}
+
+// head is the head of an object.
+type head struct {
+	kind item.Kind
+	// arg is the value of booleans and numbers, as bits for signed integers
+	// and floats, or the length of strings, bin and ext data, arrays and maps.
+	arg uint64
+	// n is the size of the head.
+	n int
+	// data is the number of bytes following the head.
+	data uint64
+	// children is the number of objects following the head.
+	children uint64
+}
+
+func parseHead(b []byte) (head, error) {
+	if len(b) == 0 {
+		return head{}, io.ErrUnexpectedEOF
+	}
+	c := b[0]
+	h := head{n: headSize(c)}
+	if len(b) < h.n {
+		return head{}, io.ErrUnexpectedEOF
+	}
+	var arg uint64
+	switch c {
+	case codeBin8, codeStr8, codeUint8, codeInt8, codeExt8:
+		arg = uint64(b[1])
+	case codeBin16, codeStr16, codeArray16, codeMap16, codeUint16, codeInt16, codeExt16:
+		arg = uint64(binary.BigEndian.Uint16(b[1:]))
+	case codeBin32, codeStr32, codeArray32, codeMap32, codeUint32, codeInt32, codeFloat32, codeExt32:
+		arg = uint64(binary.BigEndian.Uint32(b[1:]))
+	case codeUint64, codeInt64, codeFloat64:
+		arg = binary.BigEndian.Uint64(b[1:])
+	}
+
+	switch {
+	case c <= 0x7f:
+		h.kind, h.arg = item.Uint, uint64(c)
+	case c <= 0x8f:
+		h.kind, h.arg, h.children = item.Map, uint64(c&0x0f), 2*uint64(c&0x0f)
+	case c <= 0x9f:
+		h.kind, h.arg, h.children = item.Array, uint64(c&0x0f), uint64(c&0x0f)
+	case c <= 0xbf:
+		h.kind, h.arg, h.data = item.String, uint64(c&0x1f), uint64(c&0x1f)
+	case c >= 0xe0:
+		h.kind, h.arg = item.Int, uint64(int64(int8(c)))
+	}
+	if h.n == 1 && c >= 0xc0 && c < 0xe0 {
+		switch c {
+		case codeNil:
+			h.kind = item.Nil
+		case codeFalse:
+			h.kind = item.Bool
+		case codeTrue:
+			h.kind, h.arg = item.Bool, 1
+		default:
+			return head{}, fmt.Errorf("invalid type code %#x", c)
+		}
+	}
+
+	switch c {
+	case codeBin8, codeBin16, codeBin32:
+		h.kind, h.arg, h.data = item.Bytes, arg, arg
+	case codeStr8, codeStr16, codeStr32:
+		h.kind, h.arg, h.data = item.String, arg, arg
+	case codeArray16, codeArray32:
+		h.kind, h.arg, h.children = item.Array, arg, arg
+	case codeMap16, codeMap32:
+		h.kind, h.arg, h.children = item.Map, arg, 2*arg
+	case codeExt8, codeExt16, codeExt32:
+		h.kind, h.arg, h.data = item.Invalid, arg, arg
+	case codeFloat32:
+		h.kind, h.arg = item.Float, math.Float64bits(float64(math.Float32frombits(uint32(arg))))
+	case codeFloat64:
+		h.kind, h.arg = item.Float, arg
+	case codeUint8, codeUint16, codeUint32, codeUint64:
+		h.kind, h.arg = item.Uint, arg
+	case codeInt8, codeInt16, codeInt32, codeInt64:
+		var i int64
+		switch c {
+		case codeInt8:
+			i = int64(int8(arg))
+		case codeInt16:
+			i = int64(int16(arg))
+		case codeInt32:
+			i = int64(int32(arg))
+		default:
+			i = int64(arg)
+		}
+		h.kind, h.arg = item.Int, uint64(i)
+		if i >= 0 {
+			h.kind = item.Uint
+		}
+	}
+	if c >= codeFixExt1 && c <= codeFixExt {
+		h.kind, h.data = item.Invalid, 1<<(c-codeFixExt1)
+	}
+	return h, nil
+}
+
+// reader implements item.SliceReader over an encoded object.
+type reader struct {
+	b   []byte
+	off int
+}
+
+func (r *reader) Len() int {
+	return len(r.b) - r.off
+}
+
+func (r *reader) expect(k item.Kind) (head, error) {
+	h, err := parseHead(r.b[r.off:])
+	if err != nil {
+		return h, err
+	}
+	if h.kind != k {
+		return h, fmt.Errorf("expected %s, found %s", k, kindOf(h))
+	}
+	r.off += h.n
+	return h, nil
+}
+
+func kindOf(h head) string {
+	if h.kind == item.Invalid {
+		return "extension"
+	}
+	return h.kind.String()
+}
+
+func (r *reader) Peek() (item.Kind, error) {
+	h, err := parseHead(r.b[r.off:])
+	if err != nil {
+		return item.Invalid, err
+	}
+	if h.kind == item.Invalid {
+		return h.kind, fmt.Errorf("unsupported extension type")
+	}
+	return h.kind, nil
+}
+
+func (r *reader) ReadNil() error {
+	_, err := r.expect(item.Nil)
+	return err
+}
+
+func (r *reader) ReadBool() (bool, error) {
+	h, err := r.expect(item.Bool)
+	return h.arg == 1, err
+}
+
+func (r *reader) ReadInt() (int64, error) {
+	h, err := parseHead(r.b[r.off:])
+	if err != nil {
+		return 0, err
+	}
+	if h.kind == item.Uint {
+		u, err := r.ReadUint()
+		if err == nil && u > math.MaxInt64 {
+			err = fmt.Errorf("integer %d overflows int64", u)
+		}
+		return int64(u), err
+	}
+	h, err = r.expect(item.Int)
+	return int64(h.arg), err
+}
+
+func (r *reader) ReadUint() (uint64, error) {
+	h, err := r.expect(item.Uint)
+	return h.arg, err
+}
+
+func (r *reader) ReadFloat() (float64, error) {
+	h, err := r.expect(item.Float)
+	return math.Float64frombits(h.arg), err
+}
+
+func (r *reader) str(k item.Kind) ([]byte, error) {
+	h, err := r.expect(k)
+	if err != nil {
+		return nil, err
+	}
+	if h.data > uint64(len(r.b)-r.off) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := r.b[r.off : r.off+int(h.data)]
+	r.off += int(h.data)
+	return b, nil
+}
+
+func (r *reader) ReadString() (string, error) {
+	b, err := r.str(item.String)
+	return string(b), err
+}
+
+func (r *reader) ReadBytes() ([]byte, error) {
+	return r.str(item.Bytes)
+}
+
+func (r *reader) container(k item.Kind) (int, error) {
+	h, err := r.expect(k)
+	if err != nil {
+		return 0, err
+	}
+	// Every object takes at least one byte.
+	if h.children > uint64(len(r.b)-r.off) {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return int(h.arg), nil
+}
+
+func (r *reader) ReadArrayHeader() (int, error) {
+	return r.container(item.Array)
+}
+
+func (r *reader) ReadMapHeader() (int, error) {
+	return r.container(item.Map)
+}
+
+func (r *reader) Skip() ([]byte, error) {
+	start := r.off
+	for pending := uint64(1); pending > 0; pending-- {
+		h, err := parseHead(r.b[r.off:])
+		if err != nil {
+			return nil, err
+		}
+		r.off += h.n
+		if h.data+h.children > uint64(len(r.b)-r.off) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		r.off += int(h.data)
+		pending += h.children
+	}
+	return r.b[start:r.off], nil
+}
+
+// readItem appends the next object of r to buf.
+func readItem(r *bufio.Reader, buf []byte) ([]byte, error) {
+	for pending := uint64(1); pending > 0; pending-- {
+		c, err := r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(buf) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf, err
+		}
+		start := len(buf)
+		buf = append(buf, c)
+		if buf, err = readN(r, buf, uint64(headSize(c)-1)); err != nil {
+			return buf, err
+		}
+		h, err := parseHead(buf[start:])
+		if err != nil {
+			return buf, fmt.Errorf("msgpack: %w", err)
+		}
+		if buf, err = readN(r, buf, h.data); err != nil {
+			return buf, err
+		}
+		pending += h.children
+	}
+	return buf, nil
+}
+
+// readN appends n bytes of r to buf, growing it as data arrives since n is
+// untrusted.
+func readN(r io.Reader, buf []byte, n uint64) ([]byte, error) {
+	const chunk = 32 << 10
+	for n > 0 {
+		m := n
+		if m > chunk {
+			m = chunk
+		}
+		start := len(buf)
+		buf = append(buf, make([]byte, m)...)
+		if _, err := io.ReadFull(r, buf[start:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return buf[:start], err
+		}
+		n -= m
+	}
+	return buf, nil
+}
@@ -0,0 +1,82 @@
+// Package msgpack implements MessagePack (https://msgpack.org) as an
+// encoding.Driver.
+//
+// Go values are mapped like encoding/json maps them: `json` struct tags,
+// json.Marshaler/Unmarshaler and encoding.TextMarshaler/TextUnmarshaler are
+// honored, and json.Raw holds an undecoded MessagePack object. Byte slices are
+// encoded as bin. Extension types can be skipped or kept in a json.Raw, but not
+// decoded.
+package msgpack
+
+import (
+	"errors"
+	"io"
+
+	"x/encoding"
+	"x/encoding/internal/item"
+)
+
+// ContentType is the media type of MessagePack.
+const ContentType = "application/msgpack"
+
+var format = &item.Format{
+	Name:            "msgpack",
+	ErrTrailingData: errors.New("msgpack: trailing data after top-level object"),
+	NewReader:       func(data []byte) item.SliceReader { return &reader{b: data} },
+	NewWriter:       func() item.SliceWriter { return &writer{} },
+	ReadItem:        readItem,
+}
+
+// Driver is the MessagePack encoding.Driver. It implements encoding.Limiter.
+type Driver struct {
+	// Limits bound the objects decoded by the driver, see Limit.
+	Limits encoding.Limits
+}
+
+func (Driver) Marshal(v interface{}) ([]byte, error) {
+	return format.Marshal(v)
+}
+
+func (d Driver) Unmarshal(data []byte, v interface{}) error {
+	return format.Unmarshal(data, v, d.Limits)
+}
+
+func (d Driver) DecodeStream(r io.Reader, v interface{}) error {
+	return format.NewDecoder(r, d.Limits).Decode(v)
+}
+
+func (Driver) EncodeStream(w io.Writer, v interface{}) error {
+	return format.EncodeStream(w, v)
+}
+
+func (d Driver) NewDecoder(r io.Reader) encoding.Decoder {
+	return format.NewDecoder(r, d.Limits)
+}
+
+// Limit returns a Driver failing with encoding.ErrTooDeep or
+// encoding.ErrTooLarge for objects exceeding l, before they are decoded.
+func (Driver) Limit(l encoding.Limits) encoding.Driver {
+	return Driver{Limits: l}
+}
+
+func (Driver) ContentType() string {
+	return ContentType
+}
+
+// Marshal returns the MessagePack encoding of v.
+func Marshal(v interface{}) ([]byte, error) {
+	return format.Marshal(v)
+}
+
+// Unmarshal decodes the MessagePack object data into v. Objects nested more
+// than 10000 levels deep fail with encoding.ErrTooDeep.
+func Unmarshal(data []byte, v interface{}) error {
+	return format.Unmarshal(data, v, encoding.Limits{})
+}
+
+// Decoder reads successive MessagePack objects from an input stream.
+type Decoder = item.Decoder
+
+func NewDecoder(r io.Reader) *Decoder {
+	return format.NewDecoder(r, encoding.Limits{})
+}
@@ -6,15 +6,18 @@ import (
 	"io"
 
 	"github.com/goccy/go-json"
+
+	"x/encoding"
 )
 
-type Driver interface {
-	Marshal(v interface{}) ([]byte, error)
-	Unmarshal(data []byte, v interface{}) error
+// ContentType is the media type of JSON.
+const ContentType = "application/json"
 
-	DecodeStream(r io.Reader, v interface{}) error
-	EncodeStream(w io.Writer, v interface{}) error
-}
+// Driver is the encoding.Driver of a JSON implementation.
+type Driver = encoding.Driver
+
+// Decoder reads successive JSON values from a single input stream.
+type Decoder = encoding.Decoder
 
 type DefaultDriver struct{}
 
@@ -34,9 +37,33 @@ func (d DefaultDriver) EncodeStream(w io.Writer, v interface{}) error {
 	return json.NewEncoder(w).Encode(v)
 }
 
+func (d DefaultDriver) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+func (d DefaultDriver) ContentType() string {
+	return ContentType
+}
+
 // Default is the default JSON driver, which uses github.com/goccy/go-json.
 var Default Driver = DefaultDriver{}
 
+// Goccy returns a Driver using github.com/goccy/go-json.
+func Goccy() Driver {
+	return DefaultDriver{}
+}
+
+// Std returns a Driver using encoding/json.
+func Std() Driver {
+	return StdDriver{}
+}
+
+// Strict returns a Driver using encoding/json, which rejects unknown fields,
+// duplicate keys and trailing data, see StrictDriver.
+func Strict() Driver {
+	return StrictDriver{}
+}
+
 // Marshal uses the default driver.
 func Marshal(v interface{}) ([]byte, error) {
 	return Default.Marshal(v)
@@ -56,3 +83,8 @@ func DecodeStream(r io.Reader, v interface{}) error {
 func EncodeStream(w io.Writer, v interface{}) error {
 	return Default.EncodeStream(w, v)
 }
+
+// NewDecoder uses the default driver.
+func NewDecoder(r io.Reader) Decoder {
+	return encoding.NewDecoder(Default, r)
+}
@@ -0,0 +1,97 @@
+package json
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"x/encoding"
+)
+
+type testStruct struct {
+	Name string
+	Tags []string
+}
+
+// basicDriver implements no more than Driver requires.
+type basicDriver struct {
+	d StdDriver
+}
+
+func (d basicDriver) Marshal(v interface{}) ([]byte, error) {
+	return d.d.Marshal(v)
+}
+
+func (d basicDriver) Unmarshal(data []byte, v interface{}) error {
+	return d.d.Unmarshal(data, v)
+}
+
+func (d basicDriver) DecodeStream(r io.Reader, v interface{}) error {
+	return d.d.DecodeStream(r, v)
+}
+
+func (d basicDriver) EncodeStream(w io.Writer, v interface{}) error {
+	return d.d.EncodeStream(w, v)
+}
+
+func TestDrivers(t *testing.T) {
+	tests := []struct {
+		name          string
+		driver        Driver
+		wantUnknownOK bool
+	}{
+		{name: "Goccy", driver: Goccy(), wantUnknownOK: true},
+		{name: "Std", driver: Std(), wantUnknownOK: true},
+		{name: "Strict", driver: Strict(), wantUnknownOK: false},
+		{name: "Basic", driver: basicDriver{}, wantUnknownOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := testStruct{Name: "test", Tags: []string{"a", "b"}}
+			b, err := tt.driver.Marshal(want)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+			var got testStruct
+			if err := tt.driver.Unmarshal(b, &got); err != nil {
+				t.Fatalf("Unmarshal() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Unmarshal() = %v, want %v", got, want)
+			}
+
+			buf := &bytes.Buffer{}
+			for i := 0; i < 2; i++ {
+				if err := tt.driver.EncodeStream(buf, want); err != nil {
+					t.Fatalf("EncodeStream() error = %v", err)
+				}
+			}
+			if ct := encoding.ContentType(tt.driver); ct != ContentType {
+				t.Errorf("ContentType() = %s, want %s", ct, ContentType)
+			}
+			dec := encoding.NewDecoder(tt.driver, buf)
+			for i := 0; i < 2; i++ {
+				got = testStruct{}
+				if err := dec.Decode(&got); err != nil {
+					t.Fatalf("Decode() error = %v", err)
+				}
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("Decode() = %v, want %v", got, want)
+				}
+			}
+			if want := int64(2*len(b) + 1); dec.InputOffset() != want {
+				t.Errorf("InputOffset() = %d, want %d", dec.InputOffset(), want)
+			}
+
+			unknown := `{"Name":"test","Unknown":true}`
+			if err := tt.driver.Unmarshal([]byte(unknown), &got); (err == nil) != tt.wantUnknownOK {
+				t.Errorf("Unmarshal() error = %v, wantUnknownOK %v", err, tt.wantUnknownOK)
+			}
+			if err := tt.driver.DecodeStream(strings.NewReader(unknown), &got); (err == nil) != tt.wantUnknownOK {
+				t.Errorf("DecodeStream() error = %v, wantUnknownOK %v", err, tt.wantUnknownOK)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package json
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"x/encoding"
+)
+
+// ErrTooLarge and ErrTooDeep wrap encoding.ErrTooLarge and encoding.ErrTooDeep.
+var (
+	ErrTooLarge = fmt.Errorf("json: %w", encoding.ErrTooLarge)
+	ErrTooDeep  = fmt.Errorf("json: %w", encoding.ErrTooDeep)
+)
+
+// Limits bound the JSON values a LimitDriver decodes. Zero fields don't limit
+// anything.
+type Limits struct {
+	// MaxSize is the maximum size of a value in bytes.
+	MaxSize int64
+	// MaxDepth is the maximum nesting depth of arrays and objects.
+	MaxDepth int
+	// MaxStringLength is the maximum length in bytes of strings and object
+	// keys, as encoded.
+	MaxStringLength int
+}
+
+// Check returns ErrTooLarge or ErrTooDeep if the JSON value data exceeds l. It
+// does not validate data otherwise.
+func (l Limits) Check(data []byte) error {
+	s := scanner{l: l}
+	for _, c := range data {
+		if err := s.step(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LimitDriver decodes with Driver, but fails with ErrTooLarge or ErrTooDeep for
+// values exceeding Limits, before they are decoded. Its Decoder reads no more of
+// a value than the limits allow.
+type LimitDriver struct {
+	Driver
+	Limits Limits
+}
+
+// Limit returns a LimitDriver decoding with d.
+func Limit(d Driver, l Limits) Driver {
+	return LimitDriver{Driver: d, Limits: l}
+}
+
+func (d LimitDriver) Unmarshal(data []byte, v interface{}) error {
+	if err := d.Limits.Check(data); err != nil {
+		return err
+	}
+	return d.Driver.Unmarshal(data, v)
+}
+
+func (d LimitDriver) DecodeStream(r io.Reader, v interface{}) error {
+	return d.NewDecoder(r).Decode(v)
+}
+
+func (d LimitDriver) NewDecoder(r io.Reader) Decoder {
+	return &limitDecoder{d: d, r: bufio.NewReader(r)}
+}
+
+func (d LimitDriver) ContentType() string {
+	return encoding.ContentType(d.Driver)
+}
+
+// limitDecoder splits its input into values, checking the limits while reading
+// them, and decodes them with the Driver of d.
+type limitDecoder struct {
+	d   LimitDriver
+	r   *bufio.Reader
+	buf []byte
+	off int64
+	err error
+}
+
+func (dec *limitDecoder) Decode(v interface{}) error {
+	if dec.err != nil {
+		return dec.err
+	}
+	b, err := dec.next()
+	if err != nil {
+		dec.err = err
+		return err
+	}
+	return dec.d.Driver.Unmarshal(b, v)
+}
+
+// next reads the next value.
+func (dec *limitDecoder) next() ([]byte, error) {
+	if err := dec.skipSpace(); err != nil {
+		return nil, err
+	}
+	s := scanner{l: dec.d.Limits}
+	b := dec.buf[:0]
+	defer func() { dec.buf = b }()
+	for !s.done {
+		c, err := dec.r.ReadByte()
+		if err == io.EOF && s.scalar {
+			break
+		}
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if s.scalar && isDelim(c) {
+			_ = dec.r.UnreadByte()
+			break
+		}
+		if err := s.step(c); err != nil {
+			return nil, err
+		}
+		b = append(b, c)
+		dec.off++
+	}
+	return b, nil
+}
+
+func (dec *limitDecoder) skipSpace() error {
+	for {
+		c, err := dec.r.ReadByte()
+		if err != nil {
+			return err
+		}
+		if !isSpace(c) {
+			return dec.r.UnreadByte()
+		}
+		dec.off++
+	}
+}
+
+func (dec *limitDecoder) More() bool {
+	if dec.err != nil || dec.skipSpace() != nil {
+		return false
+	}
+	c, err := dec.r.Peek(1)
+	return err == nil && c[0] != ']' && c[0] != '}'
+}
+
+func (dec *limitDecoder) InputOffset() int64 {
+	return dec.off
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// isDelim reports whether c ends a number or literal.
+func isDelim(c byte) bool {
+	switch c {
+	case ',', ':', '[', ']', '{', '}', '"':
+		return true
+	}
+	return isSpace(c)
+}
+
+// scanner follows the structure of a JSON value byte by byte, enough to check
+// its limits and find its end.
+type scanner struct {
+	l      Limits
+	size   int64
+	depth  int
+	str    int
+	inStr  bool
+	escape bool
+	// scalar is set for values that are a number or literal, which end at the
+	// next delimiter.
+	scalar bool
+	done   bool
+}
+
+func (s *scanner) step(c byte) error {
+	s.size++
+	if s.l.MaxSize > 0 && s.size > s.l.MaxSize {
+		return fmt.Errorf("%w: more than %d bytes", ErrTooLarge, s.l.MaxSize)
+	}
+	if s.inStr {
+		switch {
+		case s.escape:
+			s.escape = false
+		case c == '\\':
+			s.escape = true
+		case c == '"':
+			s.inStr = false
+			s.done = s.depth == 0
+			return nil
+		}
+		s.str++
+		if s.l.MaxStringLength > 0 && s.str > s.l.MaxStringLength {
+			return fmt.Errorf("%w: string longer than %d bytes", ErrTooLarge, s.l.MaxStringLength)
+		}
+		return nil
+	}
+	switch c {
+	case '"':
+		s.inStr = true
+		s.str = 0
+	case '[', '{':
+		s.depth++
+		if s.l.MaxDepth > 0 && s.depth > s.l.MaxDepth {
+			return fmt.Errorf("%w: more than %d levels", ErrTooDeep, s.l.MaxDepth)
+		}
+	case ']', '}':
+		s.depth--
+		s.done = s.depth <= 0
+	default:
+		s.scalar = s.depth == 0 && !isSpace(c)
+	}
+	return nil
+}
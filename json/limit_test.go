@@ -0,0 +1,75 @@
+package json
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"x/encoding"
+)
+
+func TestLimits_Check(t *testing.T) {
+	l := Limits{MaxSize: 32, MaxDepth: 2, MaxStringLength: 4}
+	tests := []struct {
+		data    string
+		wantErr error
+	}{
+		{data: `{"a":[1,"abcd"]}`},
+		{data: `"a\"b"`},
+		{data: `{"a":[[1]]}`, wantErr: ErrTooDeep},
+		{data: `["abcde"]`, wantErr: ErrTooLarge},
+		{data: `{"abcde":1}`, wantErr: ErrTooLarge},
+		{data: `[1,2,3,4,5,6,7,8,9,10,11,12,13,14]`, wantErr: ErrTooLarge},
+		{data: `["[[[", "{{{"]`},
+	}
+	for _, tt := range tests {
+		if err := l.Check([]byte(tt.data)); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Check(%s) error = %v, want %v", tt.data, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLimitDriver(t *testing.T) {
+	d := Limit(Std(), Limits{MaxDepth: 2, MaxStringLength: 8})
+	var got testStruct
+	if err := d.Unmarshal([]byte(`{"Name":"test","Tags":["a"]}`), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if err := d.Unmarshal([]byte(`{"Name":"too long a name"}`), &got); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Unmarshal() error = %v, want %v", err, ErrTooLarge)
+	}
+
+	stream := " {\"Name\":\"a\"}\n12 \"s\"true[1,[]]\n[[[1]]]"
+	dec := encoding.NewDecoder(d, strings.NewReader(stream))
+	want := []interface{}{map[string]interface{}{"Name": "a"}, 12.0, "s", true, []interface{}{1.0, []interface{}{}}}
+	for _, w := range want {
+		if !dec.More() {
+			t.Fatalf("More() = false")
+		}
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		if !reflect.DeepEqual(v, w) {
+			t.Errorf("Decode() = %#v, want %#v", v, w)
+		}
+	}
+	if want := int64(len(stream) - 8); dec.InputOffset() != want {
+		t.Errorf("InputOffset() = %d, want %d", dec.InputOffset(), want)
+	}
+	var v interface{}
+	if err := dec.Decode(&v); !errors.Is(err, ErrTooDeep) {
+		t.Errorf("Decode() error = %v, want %v", err, ErrTooDeep)
+	}
+
+	dec = encoding.NewDecoder(d, strings.NewReader(`{"Name":`))
+	if err := dec.Decode(&v); err != io.ErrUnexpectedEOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	dec = encoding.NewDecoder(d, strings.NewReader(" \n"))
+	if err := dec.Decode(&v); err != io.EOF {
+		t.Errorf("Decode() error = %v, want %v", err, io.EOF)
+	}
+}
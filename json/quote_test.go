@@ -0,0 +1,23 @@
+package json
+
+import "testing"
+
+func TestAppendQuote(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{name: "Plain", s: "__codec.Test", want: `"__codec.Test"`},
+		{name: "Escaped", s: "a\"b\\c\nd\te\x01", want: `"a\"b\\c\nd\te\u0001"`},
+		{name: "Unicode", s: "héllo", want: `"héllo"`},
+		{name: "Invalid", s: "a\xffb", want: `"a` + "�" + `b"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(AppendQuote(nil, tt.s)); got != tt.want {
+				t.Errorf("AppendQuote() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
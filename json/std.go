@@ -0,0 +1,33 @@
+package json
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// StdDriver uses encoding/json.
+type StdDriver struct{}
+
+func (d StdDriver) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (d StdDriver) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (d StdDriver) DecodeStream(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+func (d StdDriver) EncodeStream(w io.Writer, v interface{}) error {
+	return json.NewEncoder(w).Encode(v)
+}
+
+func (d StdDriver) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+func (d StdDriver) ContentType() string {
+	return ContentType
+}
@@ -0,0 +1,325 @@
+package json
+
+import (
+	"bytes"
+	stdencoding "encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"x/encoding"
+)
+
+var (
+	ErrUnknownField = errors.New("unknown field")
+	ErrDuplicateKey = errors.New("duplicate key")
+	ErrTrailingData = errors.New("trailing data")
+)
+
+// StrictError reports an element of a JSON value a StrictDriver rejected. It
+// matches ErrUnknownField, ErrDuplicateKey or ErrTrailingData with errors.Is.
+type StrictError struct {
+	// Path locates the element, e.g. $.items[2].name.
+	Path string
+	Err  error
+}
+
+func (e *StrictError) Error() string {
+	return fmt.Sprintf("json: %v at %s", e.Err, e.Path)
+}
+
+func (e *StrictError) Unwrap() error {
+	return e.Err
+}
+
+// StrictDriver uses encoding/json, but fails to decode values with keys that
+// don't match any field of the struct they are decoded into, with duplicate
+// keys, or followed by anything but whitespace. These errors are of type
+// *StrictError. StrictWith checks the values of other drivers alike.
+type StrictDriver struct {
+	StdDriver
+}
+
+func (d StrictDriver) Unmarshal(data []byte, v interface{}) error {
+	return strictDriver{d: d.StdDriver}.Unmarshal(data, v)
+}
+
+// DecodeStream reads all of r, which has to hold a single value.
+func (d StrictDriver) DecodeStream(r io.Reader, v interface{}) error {
+	return strictDriver{d: d.StdDriver}.DecodeStream(r, v)
+}
+
+// NewDecoder returns a Decoder checking every value like Unmarshal.
+func (d StrictDriver) NewDecoder(r io.Reader) Decoder {
+	return strictDriver{d: d.StdDriver}.NewDecoder(r)
+}
+
+// StrictWith returns a Driver decoding with d, but checking the values it
+// decodes like StrictDriver.
+func StrictWith(d Driver) Driver {
+	return strictDriver{d: d}
+}
+
+// strictDriver is the StrictDriver of any driver.
+type strictDriver struct {
+	d Driver
+}
+
+func (d strictDriver) Marshal(v interface{}) ([]byte, error) {
+	return d.d.Marshal(v)
+}
+
+func (d strictDriver) Unmarshal(data []byte, v interface{}) error {
+	if err := checkStrict(data, reflect.TypeOf(v)); err != nil {
+		return err
+	}
+	return d.d.Unmarshal(data, v)
+}
+
+func (d strictDriver) DecodeStream(r io.Reader, v interface{}) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return d.Unmarshal(data, v)
+}
+
+func (d strictDriver) EncodeStream(w io.Writer, v interface{}) error {
+	return d.d.EncodeStream(w, v)
+}
+
+func (d strictDriver) NewDecoder(r io.Reader) Decoder {
+	return &strictDecoder{d: d, dec: encoding.NewDecoder(d.d, r)}
+}
+
+func (d strictDriver) ContentType() string {
+	return encoding.ContentType(d.d)
+}
+
+type strictDecoder struct {
+	d   strictDriver
+	dec Decoder
+	raw Raw
+}
+
+func (dec *strictDecoder) Decode(v interface{}) error {
+	dec.raw = dec.raw[:0]
+	if err := dec.dec.Decode(&dec.raw); err != nil {
+		return err
+	}
+	return dec.d.Unmarshal(dec.raw, v)
+}
+
+func (dec *strictDecoder) More() bool {
+	return dec.dec.More()
+}
+
+func (dec *strictDecoder) InputOffset() int64 {
+	return dec.dec.InputOffset()
+}
+
+// checkStrict walks the JSON value data along the type t it is decoded into.
+// Syntax errors are left to the driver to report.
+func checkStrict(data []byte, t reflect.Type) error {
+	c := strictChecker{dec: json.NewDecoder(bytes.NewReader(data))}
+	c.dec.UseNumber()
+	err := c.value(t)
+	if err == nil {
+		if _, err := c.dec.Token(); err != io.EOF {
+			return &StrictError{Path: "$", Err: ErrTrailingData}
+		}
+	}
+	var se *StrictError
+	if errors.As(err, &se) {
+		return err
+	}
+	return nil
+}
+
+type strictChecker struct {
+	dec  *json.Decoder
+	path []string
+}
+
+func (c *strictChecker) fail(err error) error {
+	return &StrictError{Path: "$" + strings.Join(c.path, ""), Err: err}
+}
+
+func (c *strictChecker) value(t reflect.Type) error {
+	tok, err := c.dec.Token()
+	if err != nil {
+		return err
+	}
+	switch tok {
+	case json.Delim('{'):
+		return c.object(target(t))
+	case json.Delim('['):
+		return c.array(target(t))
+	}
+	return nil
+}
+
+func (c *strictChecker) object(t reflect.Type) error {
+	var (
+		fields map[string]reflect.Type
+		elem   reflect.Type
+	)
+	if t != nil {
+		switch t.Kind() {
+		case reflect.Struct:
+			fields = structFields(t)
+		case reflect.Map:
+			elem = t.Elem()
+		}
+	}
+	seen := map[string]bool{}
+	for c.dec.More() {
+		tok, err := c.dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		c.path = append(c.path, pathKey(key))
+		// Keys of structs are duplicates if they match the same field.
+		name := key
+		if fields != nil {
+			var ok bool
+			if name, elem, ok = lookupField(fields, key); !ok {
+				return c.fail(ErrUnknownField)
+			}
+		}
+		if seen[name] {
+			return c.fail(ErrDuplicateKey)
+		}
+		seen[name] = true
+		if err := c.value(elem); err != nil {
+			return err
+		}
+		c.path = c.path[:len(c.path)-1]
+	}
+	_, err := c.dec.Token()
+	return err
+}
+
+func (c *strictChecker) array(t reflect.Type) error {
+	var elem reflect.Type
+	if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		elem = t.Elem()
+	}
+	for i := 0; c.dec.More(); i++ {
+		c.path = append(c.path, "["+strconv.Itoa(i)+"]")
+		if err := c.value(elem); err != nil {
+			return err
+		}
+		c.path = c.path[:len(c.path)-1]
+	}
+	_, err := c.dec.Token()
+	return err
+}
+
+func pathKey(key string) string {
+	for i, r := range key {
+		if r != '_' && !('a' <= r && r <= 'z') && !('A' <= r && r <= 'Z') && (i == 0 || !('0' <= r && r <= '9')) {
+			return "[" + strconv.Quote(key) + "]"
+		}
+	}
+	if key == "" {
+		return `[""]`
+	}
+	return "." + key
+}
+
+var (
+	unmarshalerType     = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*stdencoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// target returns the type a value is decoded into through pointers, or nil if
+// it decodes itself and anything goes.
+func target(t reflect.Type) reflect.Type {
+	for t != nil {
+		pt := reflect.PointerTo(t)
+		if pt.Implements(unmarshalerType) || pt.Implements(textUnmarshalerType) {
+			return nil
+		}
+		if t.Kind() != reflect.Pointer {
+			return t
+		}
+		t = t.Elem()
+	}
+	return nil
+}
+
+var fieldCache sync.Map // map[reflect.Type]map[string]reflect.Type
+
+// structFields returns the types of the fields of the struct t by their JSON
+// names, including the fields of embedded structs.
+func structFields(t reflect.Type) map[string]reflect.Type {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(map[string]reflect.Type)
+	}
+	fields := map[string]reflect.Type{}
+	addFields(fields, t, map[reflect.Type]bool{})
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func addFields(fields map[string]reflect.Type, t reflect.Type, visited map[reflect.Type]bool) {
+	if visited[t] {
+		return
+	}
+	visited[t] = true
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if f.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			embedded = append(embedded, ft)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	// Fields of embedded structs don't override shallower ones.
+	for _, et := range embedded {
+		promoted := map[string]reflect.Type{}
+		addFields(promoted, et, visited)
+		for name, ft := range promoted {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+}
+
+// lookupField finds the name and type of the field key matches, preferring an
+// exact match like encoding/json does.
+func lookupField(fields map[string]reflect.Type, key string) (string, reflect.Type, bool) {
+	if t, ok := fields[key]; ok {
+		return key, t, true
+	}
+	for name, t := range fields {
+		if strings.EqualFold(name, key) {
+			return name, t, true
+		}
+	}
+	return "", nil, false
+}
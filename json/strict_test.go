@@ -0,0 +1,82 @@
+package json
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"x/encoding"
+)
+
+type strictInner struct {
+	ID   int    `json:"id,string"`
+	Skip string `json:"-"`
+}
+
+type strictEmbedded struct {
+	Shared string
+}
+
+type strictStruct struct {
+	strictEmbedded
+	Name    string                 `json:"name"`
+	Items   []strictInner          `json:"items"`
+	ByKey   map[string]strictInner `json:"by_key"`
+	Any     interface{}            `json:"any"`
+	Raw     Raw                    `json:"raw"`
+	At      time.Time              `json:"at"`
+	Pointer *strictInner           `json:"pointer"`
+}
+
+func TestStrictDriver(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		wantErr  error
+		wantPath string
+	}{
+		{
+			name: "OK",
+			data: `{"name":"a","Shared":"s","items":[{"id":"1"}],"by_key":{"k":{"ID":"2"}},` +
+				`"any":{"x":1},"raw":{"y":2},"at":"2020-01-01T00:00:00Z","pointer":{"id":"3"}}`,
+		},
+		{name: "Unknown", data: `{"name":"a","other":1}`, wantErr: ErrUnknownField, wantPath: "$.other"},
+		{name: "Skipped", data: `{"items":[{"id":"1"},{"Skip":""}]}`, wantErr: ErrUnknownField, wantPath: "$.items[1].Skip"},
+		{name: "Map", data: `{"by_key":{"a b":{"x":1}}}`, wantErr: ErrUnknownField, wantPath: `$.by_key["a b"].x`},
+		{name: "Pointer", data: `{"pointer":{"id":"1","id":"2"}}`, wantErr: ErrDuplicateKey, wantPath: "$.pointer.id"},
+		{name: "DuplicateCase", data: `{"name":"a","Name":"b"}`, wantErr: ErrDuplicateKey, wantPath: "$.Name"},
+		{name: "MapCase", data: `{"by_key":{"k":{},"K":{}}}`},
+		{name: "DuplicateAny", data: `{"any":{"x":1,"x":2}}`, wantErr: ErrDuplicateKey, wantPath: "$.any.x"},
+		{name: "Trailing", data: `{"name":"a"} {}`, wantErr: ErrTrailingData, wantPath: "$"},
+		{name: "Garbage", data: `{"name":"a"}x`, wantErr: ErrTrailingData, wantPath: "$"},
+	}
+	for _, d := range []Driver{Strict(), StrictDriver{StdDriver{}}, StrictWith(Goccy())} {
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var v strictStruct
+				err := d.Unmarshal([]byte(tt.data), &v)
+				var se *StrictError
+				if !errors.Is(err, tt.wantErr) || (err != nil && (!errors.As(err, &se) || se.Path != tt.wantPath)) {
+					t.Errorf("Unmarshal() error = %v, want %v at %s", err, tt.wantErr, tt.wantPath)
+				}
+				err = d.DecodeStream(strings.NewReader(tt.data), &v)
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("DecodeStream() error = %v, want %v", err, tt.wantErr)
+				}
+			})
+		}
+	}
+
+	var v strictStruct
+	if err := Strict().Unmarshal([]byte(`{"name":`), &v); err == nil || errors.As(err, new(*StrictError)) {
+		t.Errorf("Unmarshal() error = %v, want syntax error", err)
+	}
+	dec := encoding.NewDecoder(Strict(), strings.NewReader(`{"name":"a"} {"name":"b","x":1}`))
+	if err := dec.Decode(&v); err != nil || v.Name != "a" {
+		t.Errorf("Decode() = %v, %v", v.Name, err)
+	}
+	if err := dec.Decode(&v); !errors.Is(err, ErrUnknownField) {
+		t.Errorf("Decode() error = %v, want %v", err, ErrUnknownField)
+	}
+}